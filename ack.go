@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+const (
+	ackCallbackData   = "ack"
+	unackCallbackData = "unack"
+
+	// max alerts listed by /alerts
+	alertsCommandLimit = 50
+)
+
+func ackKeyboard() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("✅ Ack", ackCallbackData)),
+	)
+}
+
+// ackedKeyboard shows who acknowledged alerts, pressing it removes acknowledgement
+func ackedKeyboard(ackedBy string) tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(tgbotapi.NewInlineKeyboardButtonData("👀 acked by "+ackedBy, unackCallbackData)),
+	)
+}
+
+// alertsKeyboard returns keyboard for firing alerts, nil when acks are not available
+func (app *Application) alertsKeyboard(alerts *Alerts) interface{} {
+	firing := alerts.Firing()
+	if app.store == nil || len(firing) == 0 {
+		return nil
+	}
+
+	acks, err := app.store.Acks()
+	if err != nil {
+		log.Println("Error while reading acks:", err)
+		return ackKeyboard()
+	}
+
+	ackedBy := ""
+	for _, alert := range firing {
+		ack, ok := acks[alert.ID()]
+		if !ok {
+			return ackKeyboard()
+		}
+
+		ackedBy = ack.AckedBy
+	}
+
+	return ackedKeyboard(ackedBy)
+}
+
+func userName(user *tgbotapi.User) string {
+	if user == nil {
+		return "unknown"
+	}
+
+	if user.UserName != "" {
+		return "@" + user.UserName
+	}
+
+	return user.FirstName
+}
+
+// messageNotifications returns firing alerts delivered in message
+func (app *Application) messageNotifications(chatID int64, messageID int, now time.Time) ([]store.Notification, error) {
+	notifications, err := app.store.History(store.HistoryFilter{
+		ChatID:    chatID,
+		MessageID: messageID,
+		Since:     now.Add(-app.config.HistoryRetention.Duration),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	firing := make([]store.Notification, 0, len(notifications))
+	for _, n := range notifications {
+		if n.Status != "resolved" {
+			firing = append(firing, n)
+		}
+	}
+
+	return firing, nil
+}
+
+// ackMessage acknowledges alerts delivered in message. Alerts are acknowledged by
+// fingerprint, so copies of the message in other chats are acknowledged too
+func (app *Application) ackMessage(chatID int64, messageID int, user string, now time.Time) ([]store.Ack, []store.Notification, error) {
+	notifications, err := app.messageNotifications(chatID, messageID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	acks := make([]store.Ack, 0, len(notifications))
+	for _, n := range notifications {
+		acks = append(acks, store.Ack{
+			Fingerprint: n.Fingerprint,
+			AlertName:   n.AlertName,
+			ChatID:      chatID,
+			MessageID:   messageID,
+			AckedBy:     user,
+			AckedAt:     now,
+		})
+	}
+
+	added, err := app.store.PutAcks(acks)
+
+	return added, notifications, err
+}
+
+// unackMessage removes acknowledgement of alerts delivered in message
+func (app *Application) unackMessage(chatID int64, messageID int, now time.Time) ([]store.Ack, []store.Notification, error) {
+	notifications, err := app.messageNotifications(chatID, messageID, now)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	fingerprints := make([]string, 0, len(notifications))
+	for _, n := range notifications {
+		fingerprints = append(fingerprints, n.Fingerprint)
+	}
+
+	removed, err := app.store.DeleteAcks(fingerprints)
+
+	return removed, notifications, err
+}
+
+// clearAcks forgets acknowledgements of resolved alerts, so next firing needs new ack
+func (app *Application) clearAcks(alerts *Alerts) {
+	if app.store == nil {
+		return
+	}
+
+	resolved := alerts.Resolved()
+	if len(resolved) == 0 {
+		return
+	}
+
+	fingerprints := make([]string, 0, len(resolved))
+	for _, alert := range resolved {
+		fingerprints = append(fingerprints, alert.ID())
+	}
+
+	if _, err := app.store.DeleteAcks(fingerprints); err != nil {
+		log.Println("Error while removing acks:", err)
+	}
+}
+
+// updateAckKeyboard replaces keyboard of message with alerts, keyboard is attached to
+// the last message of notification
+func (app *Application) updateAckKeyboard(chatID int64, notifications []store.Notification, keyboard tgbotapi.InlineKeyboardMarkup) {
+	if len(notifications) == 0 || len(notifications[0].MessageIDs) == 0 {
+		return
+	}
+
+	messageIDs := notifications[0].MessageIDs
+	edit := tgbotapi.NewEditMessageReplyMarkup(chatID, messageIDs[len(messageIDs)-1], keyboard)
+
+	if _, err := app.botSend(edit); err != nil {
+		log.Println("Error while updating ack keyboard:", chatID, err)
+	}
+}
+
+// toggleAck acknowledges or removes acknowledgement of alerts in message and returns text for user
+func (app *Application) toggleAck(ack bool, chatID int64, messageID int, user *tgbotapi.User) string {
+	if app.store == nil {
+		return "Acknowledgements are disabled, set state_path in config"
+	}
+
+	var (
+		changed       []store.Ack
+		notifications []store.Notification
+		err           error
+	)
+
+	if ack {
+		changed, notifications, err = app.ackMessage(chatID, messageID, userName(user), time.Now())
+	} else {
+		changed, notifications, err = app.unackMessage(chatID, messageID, time.Now())
+	}
+
+	if err != nil {
+		log.Println("Error while changing acks:", chatID, err)
+		return "Cannot change acknowledgement, try again later"
+	}
+
+	if len(notifications) == 0 {
+		return "No firing alerts in this message"
+	}
+
+	if ack {
+		app.updateAckKeyboard(chatID, notifications, ackedKeyboard(userName(user)))
+	} else {
+		app.updateAckKeyboard(chatID, notifications, ackKeyboard())
+	}
+
+	if len(changed) == 0 && ack {
+		return "Alerts are already acknowledged"
+	}
+
+	if len(changed) == 0 {
+		return "Alerts are not acknowledged"
+	}
+
+	if ack {
+		return fmt.Sprintf("%v acknowledged %d alert(s)", userName(user), len(changed))
+	}
+
+	return fmt.Sprintf("%v removed acknowledgement of %d alert(s)", userName(user), len(changed))
+}
+
+// callbackQuery handles inline keyboard buttons
+func (app *Application) callbackQuery(query *tgbotapi.CallbackQuery) {
+	text := ""
+
+	if query.Message != nil && query.Message.Chat != nil {
+		chat := query.Message.Chat
+
+		// buttons share permissions with commands doing the same
+		command := ""
+		switch {
+		case query.Data == ackCallbackData:
+			command = "ack"
+		case query.Data == unackCallbackData:
+			command = "unack"
+		case strings.HasPrefix(query.Data, expireCallbackPrefix):
+			command = "unsilence"
+		}
+
+		switch {
+		case command == "":
+		case !app.allowedCommand(command, chat, query.From):
+			text = fmt.Sprintf("You are not allowed to use /%v", command)
+		case command == "ack":
+			text = app.toggleAck(true, chat.ID, query.Message.MessageID, query.From)
+		case command == "unack":
+			text = app.toggleAck(false, chat.ID, query.Message.MessageID, query.From)
+		case command == "unsilence":
+			text = app.expireSilence(strings.TrimPrefix(query.Data, expireCallbackPrefix), query.From)
+			app.replyText(query.Message, html.EscapeString(text), nil)
+		}
+	}
+
+	if _, err := app.bot.AnswerCallbackQuery(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Println("Error while answering callback query:", err)
+	}
+}
+
+// ackCommand handles /ack sent as reply to alert message
+func (app *Application) ackCommand(message *tgbotapi.Message, args []string) {
+	app.replyAckCommand(message, true)
+}
+
+// unackCommand handles /unack sent as reply to alert message
+func (app *Application) unackCommand(message *tgbotapi.Message, args []string) {
+	app.replyAckCommand(message, false)
+}
+
+func (app *Application) replyAckCommand(message *tgbotapi.Message, ack bool) {
+	text := fmt.Sprintf("Reply to alert message with /%v", message.Command())
+
+	if message.ReplyToMessage != nil {
+		text = app.toggleAck(ack, message.Chat.ID, message.ReplyToMessage.MessageID, message.From)
+	}
+
+	app.replyText(message, html.EscapeString(text), nil)
+}
+
+// firingAlerts returns the latest notification of every alert still firing in chat
+func (app *Application) firingAlerts(chatID int64, now time.Time) ([]store.Notification, error) {
+	notifications, err := app.store.History(store.HistoryFilter{
+		ChatID: chatID,
+		Since:  now.Add(-app.config.HistoryRetention.Duration),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	firing := make([]store.Notification, 0)
+
+	// history is ordered from newest to oldest
+	for _, n := range notifications {
+		if seen[n.Fingerprint] {
+			continue
+		}
+		seen[n.Fingerprint] = true
+
+		if n.Status != "resolved" {
+			firing = append(firing, n)
+		}
+	}
+
+	return firing, nil
+}
+
+// alertsCommand answers /alerts with alerts firing in chat, not acknowledged alerts go first
+func (app *Application) alertsCommand(message *tgbotapi.Message, args []string) {
+	text := new(bytes.Buffer)
+
+	if app.store == nil {
+		text.WriteString("Alerts list is disabled, set <code>state_path</code> in config")
+	} else if firing, err := app.firingAlerts(message.Chat.ID, time.Now()); err != nil {
+		log.Println("Error while reading firing alerts:", err)
+		text.WriteString("Cannot read firing alerts")
+	} else if acks, err := app.store.Acks(); err != nil {
+		log.Println("Error while reading acks:", err)
+		text.WriteString("Cannot read firing alerts")
+	} else {
+		sort.SliceStable(firing, func(i, j int) bool {
+			_, iAcked := acks[firing[i].Fingerprint]
+			_, jAcked := acks[firing[j].Fingerprint]
+
+			return !iAcked && jAcked
+		})
+
+		fmt.Fprintf(text, "<b>Firing alerts: %d</b>\n", len(firing))
+
+		for idx, n := range firing {
+			if idx == alertsCommandLimit {
+				fmt.Fprintf(text, "\n... and %d more", len(firing)-idx)
+				break
+			}
+
+			fmt.Fprintf(text, "\n<code>%v</code>", html.EscapeString(n.AlertName))
+			if instance := n.Labels["instance"]; instance != "" {
+				fmt.Fprintf(text, " %v", html.EscapeString(instance))
+			}
+
+			if !n.StartsAt.IsZero() {
+				fmt.Fprintf(text, " since %v", app.formatTime(n.StartsAt))
+			}
+
+			if ack, ok := acks[n.Fingerprint]; ok {
+				fmt.Fprintf(text, " 👀 %v", html.EscapeString(ack.AckedBy))
+			}
+		}
+	}
+
+	app.replyText(message, text.String(), nil)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/cluster"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+// rateLimiter spaces out requests of one bot to Telegram API, allows bursts up to
+// burst requests. Nil limiter does not limit
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	burst    time.Duration
+	// time when bucket becomes full again
+	full time.Time
+}
+
+func newRateLimiter(perSecond int) *rateLimiter {
+	if perSecond <= 0 {
+		return nil
+	}
+
+	interval := time.Second / time.Duration(perSecond)
+
+	return &rateLimiter{interval: interval, burst: interval * time.Duration(perSecond)}
+}
+
+// reserve takes a slot for request made at now and returns how long to wait before it
+func (limiter *rateLimiter) reserve(now time.Time) time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if limiter.full.Before(now) {
+		limiter.full = now
+	}
+
+	wait := limiter.full.Sub(now) - limiter.burst + limiter.interval
+	limiter.full = limiter.full.Add(limiter.interval)
+
+	if wait < 0 {
+		return 0
+	}
+
+	return wait
+}
+
+func (limiter *rateLimiter) Wait() {
+	if limiter == nil {
+		return
+	}
+
+	time.Sleep(limiter.reserve(time.Now()))
+}
+
+// botSend sends request to Telegram respecting send rate of bot
+func (app *Application) botSend(c tgbotapi.Chattable) (tgbotapi.Message, error) {
+	app.limiter.Wait()
+
+	return app.bot.Send(c)
+}
+
+// newBots creates applications for additional bots of config, they share stats with app
+func (app *Application) newBots() map[string]*Application {
+	bots := make(map[string]*Application, len(app.config.Bots))
+
+	for _, bot := range app.config.Bots {
+		child := NewApplicationWithConfig(app.config.BotConfig(bot))
+		child.stats = app.stats
+		child.name = bot.Name
+		bots[bot.Name] = child
+	}
+
+	return bots
+}
+
+// alertBot returns application of bot named by first segment of webhook path and the
+// rest of path with chat ids. Paths without bot name belong to app
+func (app *Application) alertBot(path string) (*Application, string) {
+	segments := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)
+
+	if _, err := strconv.ParseInt(segments[0], 10, 64); err == nil {
+		return app, path
+	}
+
+	bot, ok := app.bots[segments[0]]
+	if !ok {
+		return app, path
+	}
+
+	if len(segments) == 1 {
+		return bot, ""
+	}
+
+	return bot, segments[1]
+}
+
+// start connects bots to Telegram and starts leader work, replica of cluster starts it
+// when it takes leader lock
+func (app *Application) start() {
+	app.connect()
+
+	if app.config.Cluster == nil {
+		app.lead()
+		return
+	}
+
+	claims, err := cluster.NewFileClaims(app.config.Cluster.ClaimsPath, app.config.Cluster.ClaimTTL.Duration)
+	if err != nil {
+		log.Fatalf("cant open cluster claims %v: %v", app.config.Cluster.ClaimsPath, err)
+	}
+
+	var spool *cluster.Spool
+	if app.config.Cluster.SpoolPath != "" {
+		if spool, err = cluster.NewSpool(app.config.Cluster.SpoolPath); err != nil {
+			log.Fatalf("cant open cluster spool %v: %v", app.config.Cluster.SpoolPath, err)
+		}
+	}
+
+	app.joinCluster(claims, spool)
+
+	// waiting is a job, so bots are not drained while replica becomes leader
+	app.runJob(func() {
+		lock := cluster.NewFileLock(app.config.Cluster.LockPath)
+		if !cluster.WaitLeader(lock, leaderRetryInterval, app.ctx.Done(), func(err error) {
+			log.Println("Error while taking leader lock:", err)
+		}) {
+			return
+		}
+
+		log.Println("Replica became cluster leader")
+		app.lead()
+
+		if spool != nil {
+			app.runJob(app.takeSpooled)
+		}
+	})
+}
+
+// connect creates Telegram clients of bots
+func (app *Application) connect() {
+	bot, err := tgbotapi.NewBotAPI(app.config.TelegramToken)
+	if err != nil {
+		log.Fatalf("cant start bot with token %v: %v", app.config.TelegramToken, err)
+	}
+
+	app.bot = bot
+	app.telegramChecked(time.Now(), nil)
+	app.runJob(app.checkTelegram)
+
+	if app.config.Debug {
+		app.bot.Debug = true
+		log.Printf("Authorised on account %s", app.bot.Self.UserName)
+	}
+
+	for _, child := range app.bots {
+		child.connect()
+	}
+}
+
+// lead opens state, runs background jobs and receives Telegram updates
+func (app *Application) lead() {
+	var err error
+
+	if app.config.StatePath != "" {
+		if app.store, err = store.Open(app.config.StatePath); err != nil {
+			log.Fatalf("cant open state %v: %v", app.config.StatePath, err)
+		}
+
+		app.runJob(app.flushOutbox)
+		app.runJob(app.pruneHistory)
+		app.runJob(app.releaseHeldAlerts)
+		app.runJob(app.sendDigests)
+		app.runJob(app.runEscalations)
+		app.runJob(app.releaseMutes)
+	}
+
+	if len(app.config.Watchdogs) > 0 {
+		app.runJob(app.runWatchdogs)
+	}
+
+	if app.config.TelegramWebhook != nil {
+		if err := app.setTelegramWebhook(); err != nil {
+			log.Fatalf("cant set webhook %v: %v", app.config.TelegramWebhook.Endpoint(), err)
+		}
+	} else {
+		app.runJob(func() { app.telegramBot(app.bot) })
+	}
+
+	atomic.StoreInt32(&app.standby, 0)
+
+	for _, child := range app.bots {
+		child.lead()
+	}
+}
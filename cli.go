@@ -0,0 +1,58 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+)
+
+// subcommands are run instead of the bot when first argument matches command name,
+// returned value is process exit code
+var subcommands = map[string]func(args []string) int{
+	"check-config": checkConfigCommand,
+	"replay":       replayCommand,
+}
+
+// validateConfig returns all problems of config, bot does not start with them
+func (app *Application) validateConfig() []error {
+	errs := app.config.Validate(app.TextTemplateFuncMap())
+
+	return append(errs, app.validateCommandPermissions()...)
+}
+
+// checkConfigCommand loads config file without requiring Telegram token
+// and reports all found problems
+//
+//	prometheus_tbot check-config -c config.yml
+func checkConfigCommand(args []string) int {
+	flags := flag.NewFlagSet("check-config", flag.ExitOnError)
+	configPath := flags.String(appconfig.ConfigPathFlag, os.Getenv(appconfig.EnvPrefix+"_CONFIG_PATH"), "Path to config file")
+	flags.Parse(args)
+
+	if *configPath == "" {
+		fmt.Fprintln(os.Stderr, "no config path provided, use -c path/to/config.yml")
+		return 2
+	}
+
+	config, err := appconfig.Load(*configPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	errs := NewApplicationWithConfig(config).validateConfig()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "%v: %v\n", *configPath, err)
+	}
+
+	if len(errs) > 0 {
+		fmt.Fprintf(os.Stderr, "%v: %d problem(s) found\n", *configPath, len(errs))
+		return 1
+	}
+
+	fmt.Printf("%v: OK\n", *configPath)
+
+	return 0
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pechorin/prometheus_tbot/pkg/cluster"
+)
+
+const (
+	// how often standby replica tries to take leader lock
+	leaderRetryInterval = 5 * time.Second
+	// how often leader takes webhooks spooled by standby replicas
+	spoolCheckInterval = time.Second
+)
+
+// spooledWebhook is webhook accepted by standby replica for leader
+type spooledWebhook struct {
+	Bot     string          `json:"bot"`
+	Path    string          `json:"path"`
+	ChatIDs []int64         `json:"chat_ids"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// joinCluster makes app and its bots standby replica which only delivers webhooks
+// until it becomes leader. Spool is nil when it is not configured
+func (app *Application) joinCluster(claims cluster.Claims, spool *cluster.Spool) {
+	app.claims = claims
+	app.spool = spool
+	atomic.StoreInt32(&app.standby, 1)
+
+	for _, child := range app.bots {
+		child.joinCluster(claims, spool)
+	}
+}
+
+// isStandby reports whether other replica of cluster holds leader lock
+func (app *Application) isStandby() bool {
+	return atomic.LoadInt32(&app.standby) == 1
+}
+
+// forwardsWebhooks reports whether standby replica passes webhooks to leader instead of
+// delivering them. Leader holds state and watches heartbeats, heartbeat received by
+// standby would not reach watchdog of leader
+func (app *Application) forwardsWebhooks() bool {
+	return app.isStandby() && (app.config.StatePath != "" || len(app.config.Watchdogs) > 0)
+}
+
+// claimNotification reports whether notification should be delivered by this replica.
+// Notification is identified by webhook path, group key and alerts, so replicas
+// accepting the same webhook from Alertmanager peers deliver it once
+func (app *Application) claimNotification(path string, alerts *Alerts) bool {
+	if app.claims == nil {
+		return true
+	}
+
+	ok, err := app.claims.Claim(path+"\xff"+alerts.GroupKey+"\xff"+alerts.Fingerprint(), time.Now())
+	if err != nil {
+		// duplicate is better than lost notification
+		log.Println("Error while claiming notification:", err)
+		return true
+	}
+
+	return ok
+}
+
+// spoolWebhook passes webhook accepted by standby replica to leader
+func (app *Application) spoolWebhook(c *gin.Context, alerts *Alerts, chatIds []int64, payload []byte) {
+	if app.spool == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"desc": "standby replica, state is held by cluster leader",
+		})
+
+		return
+	}
+
+	data, err := json.Marshal(spooledWebhook{Bot: app.name, Path: c.Request.URL.Path, ChatIDs: chatIds, Payload: payload})
+	if err == nil {
+		err = app.spool.Put(data, time.Now())
+	}
+
+	if err != nil {
+		log.Println("Error while spooling webhook:", err)
+
+		c.JSON(http.StatusServiceUnavailable, gin.H{"desc": "cant pass webhook to cluster leader", "errstr": err.Error()})
+		return
+	}
+
+	app.stats.WebhookAccepted(alerts.Receiver, time.Now())
+
+	c.String(http.StatusOK, "OK, queued for cluster leader")
+}
+
+// takeSpooled delivers webhooks spooled by standby replicas until shutdown
+func (app *Application) takeSpooled() {
+	app.every(spoolCheckInterval, func(time.Time) {
+		if err := app.spool.Take(app.acceptSpooled); err != nil && app.ctx.Err() == nil {
+			log.Println("Error while taking spooled webhooks:", err)
+		}
+	})
+}
+
+// acceptSpooled delivers spooled webhook like HTTPAlertHandler, on shutdown webhook is
+// left in spool for next leader
+func (app *Application) acceptSpooled(data []byte) error {
+	if err := app.ctx.Err(); err != nil {
+		return err
+	}
+
+	webhook := spooledWebhook{}
+	if err := json.Unmarshal(data, &webhook); err != nil {
+		log.Println("Error while reading spooled webhook:", err)
+		return nil
+	}
+
+	bot := app
+	if webhook.Bot != "" {
+		if bot = app.bots[webhook.Bot]; bot == nil {
+			log.Println("Spooled webhook for unknown bot:", webhook.Bot)
+			return nil
+		}
+	}
+
+	alerts := new(Alerts)
+	if err := json.Unmarshal(webhook.Payload, alerts); err != nil {
+		log.Println("Error while reading spooled alerts:", err)
+		return nil
+	}
+
+	if status, message := bot.acceptAlerts(webhook.Path, alerts, webhook.ChatIDs); status != http.StatusOK {
+		log.Println("Spooled webhook rejected:", message)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+)
+
+// BotCommand is a Telegram bot command available in chats
+type BotCommand struct {
+	Name        string
+	Args        string
+	Description string
+	// required arguments count, usage is shown when less given
+	MinArgs int
+	// role used when command_permissions has no entry for command
+	DefaultRole appconfig.Role
+	Handler     func(message *tgbotapi.Message, args []string)
+}
+
+func (command *BotCommand) Usage() string {
+	if command.Args == "" {
+		return "/" + command.Name
+	}
+
+	return "/" + command.Name + " " + command.Args
+}
+
+// botCommands returns commands in order they are listed in /help
+func (app *Application) botCommands() []*BotCommand {
+	return []*BotCommand{
+		{Name: "help", Description: "list of commands", DefaultRole: appconfig.RoleEveryone, Handler: app.helpCommand},
+		{Name: "chatid", Description: "show current chat id", DefaultRole: appconfig.RoleEveryone, Handler: app.chatIDCommand},
+		{Name: "status", Description: "bot version, uptime and delivery stats", DefaultRole: appconfig.RoleAdmin, Handler: app.statusCommand},
+		{Name: "alerts", Description: "alerts firing in chat, not acknowledged first", DefaultRole: appconfig.RoleEveryone, Handler: app.alertsCommand},
+		{Name: "history", Args: "[alertname] [period]", Description: "alerts delivered to chat during period (default 24h)", DefaultRole: appconfig.RoleEveryone, Handler: app.historyCommand},
+		{Name: "ack", Description: "reply to alert message to acknowledge its alerts and stop escalation", DefaultRole: appconfig.RoleMember, Handler: app.ackCommand},
+		{Name: "unack", Description: "reply to alert message to remove acknowledgement", DefaultRole: appconfig.RoleMember, Handler: app.unackCommand},
+		{Name: "silence", Args: "matchers duration [reason]", Description: "create Alertmanager silence", MinArgs: 2, DefaultRole: appconfig.RoleAdmin, Handler: app.silenceCommand},
+		{Name: "silences", Description: "active silences with buttons to expire them", DefaultRole: appconfig.RoleMember, Handler: app.silencesCommand},
+		{Name: "unsilence", Args: "id", Description: "expire silence, short id from /silences works too", MinArgs: 1, DefaultRole: appconfig.RoleAdmin, Handler: app.unsilenceCommand},
+		{Name: "mute", Args: "[duration] [matchers]", Description: "mute alerts in this chat, without arguments shows current mute", DefaultRole: appconfig.RoleMember, Handler: app.muteCommand},
+		{Name: "unmute", Description: "unmute chat and send summary of muted alerts", DefaultRole: appconfig.RoleMember, Handler: app.unmuteCommand},
+		{Name: "subscribe", Args: "matchers", Description: "deliver alerts matching all matchers to this chat", MinArgs: 1, DefaultRole: appconfig.RoleChatAdmin, Handler: app.subscribeCommand},
+		{Name: "subscriptions", Description: "subscriptions of this chat", DefaultRole: appconfig.RoleEveryone, Handler: app.subscriptionsCommand},
+		{Name: "unsubscribe", Args: "id", Description: "remove subscription", MinArgs: 1, DefaultRole: appconfig.RoleChatAdmin, Handler: app.unsubscribeCommand},
+	}
+}
+
+func (app *Application) findBotCommand(name string) *BotCommand {
+	name = strings.ToLower(name)
+
+	for _, command := range app.botCommands() {
+		if command.Name == name {
+			return command
+		}
+	}
+
+	return nil
+}
+
+// validateCommandPermissions reports command_permissions entries for unknown commands
+func (app *Application) validateCommandPermissions() []error {
+	errs := make([]error, 0)
+
+	for name := range app.config.CommandPermissions {
+		if app.findBotCommand(name) == nil {
+			errs = append(errs, fmt.Errorf("command_permissions.%v: unknown command", name))
+		}
+	}
+
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+
+	return errs
+}
+
+// commandRole returns role required for command, command_permissions overrides default
+func (app *Application) commandRole(command *BotCommand) appconfig.Role {
+	if role, ok := app.config.CommandPermissions[command.Name]; ok {
+		return role
+	}
+
+	return command.DefaultRole
+}
+
+// addressedToBot reports whether command is for this bot, commands like /ack@other_bot
+// in group chats are for other bots
+func (app *Application) addressedToBot(message *tgbotapi.Message) bool {
+	command := message.CommandWithAt()
+
+	idx := strings.Index(command, "@")
+	if idx < 0 {
+		return true
+	}
+
+	return strings.EqualFold(command[idx+1:], app.bot.Self.UserName)
+}
+
+// dispatchCommand runs command handler when user is allowed to run it
+func (app *Application) dispatchCommand(message *tgbotapi.Message) {
+	if !message.IsCommand() || !app.addressedToBot(message) {
+		return
+	}
+
+	command := app.findBotCommand(message.Command())
+	if command == nil {
+		return
+	}
+
+	if !app.allowed(command, message.Chat, message.From) {
+		app.replyText(message, fmt.Sprintf("You are not allowed to use /%v", command.Name), nil)
+		return
+	}
+
+	args := strings.Fields(message.CommandArguments())
+	if len(args) < command.MinArgs {
+		app.replyText(message, fmt.Sprintf("Usage: <code>%v</code>", html.EscapeString(command.Usage())), nil)
+		return
+	}
+
+	command.Handler(message, args)
+}
+
+// allowed checks user role in chat, admins from admin_user_ids may run everything
+func (app *Application) allowed(command *BotCommand, chat *tgbotapi.Chat, user *tgbotapi.User) bool {
+	role := app.commandRole(command)
+
+	if role == appconfig.RoleEveryone {
+		return true
+	}
+
+	if app.isAdmin(user) {
+		return true
+	}
+
+	if user == nil || chat == nil {
+		return false
+	}
+
+	switch role {
+	case appconfig.RoleMember:
+		return app.isMember(user)
+	case appconfig.RoleChatAdmin:
+		return app.isChatAdmin(chat, user)
+	}
+
+	return false
+}
+
+// allowedCommand checks permission of command by name, used by inline buttons
+func (app *Application) allowedCommand(name string, chat *tgbotapi.Chat, user *tgbotapi.User) bool {
+	command := app.findBotCommand(name)
+
+	return command != nil && app.allowed(command, chat, user)
+}
+
+// isAdmin reports whether user is listed in admin_user_ids
+func (app *Application) isAdmin(user *tgbotapi.User) bool {
+	if user == nil {
+		return false
+	}
+
+	for _, id := range app.config.AdminUserIDs {
+		if id == user.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMember reports whether user is member of any chat from member_chat_ids
+func (app *Application) isMember(user *tgbotapi.User) bool {
+	if len(app.config.MemberChatIDs) == 0 {
+		return true
+	}
+
+	for _, chatID := range app.config.MemberChatIDs {
+		member, err := app.bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chatID, UserID: user.ID})
+		if err != nil {
+			log.Println("Error while checking chat member:", chatID, err)
+			continue
+		}
+
+		if member.IsCreator() || member.IsAdministrator() || member.IsMember() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isChatAdmin reports whether user administers chat, in private chat user is its admin
+func (app *Application) isChatAdmin(chat *tgbotapi.Chat, user *tgbotapi.User) bool {
+	if chat.IsPrivate() {
+		return true
+	}
+
+	member, err := app.bot.GetChatMember(tgbotapi.ChatConfigWithUser{ChatID: chat.ID, UserID: user.ID})
+	if err != nil {
+		log.Println("Error while checking chat member:", chat.ID, err)
+		return false
+	}
+
+	return member.IsCreator() || member.IsAdministrator()
+}
+
+func (app *Application) helpCommand(message *tgbotapi.Message, args []string) {
+	text := new(bytes.Buffer)
+	text.WriteString("<b>Commands</b>\n")
+
+	for _, command := range app.botCommands() {
+		fmt.Fprintf(text, "\n<code>%v</code> - %v", html.EscapeString(command.Usage()), html.EscapeString(command.Description))
+
+		if role := app.commandRole(command); role != appconfig.RoleEveryone {
+			fmt.Fprintf(text, " <i>(%v)</i>", role)
+		}
+	}
+
+	app.replyText(message, text.String(), nil)
+}
+
+func (app *Application) chatIDCommand(message *tgbotapi.Message, args []string) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, fmt.Sprintf("Chat id is '%d'", message.Chat.ID))
+	if _, err := app.botSend(msg); err != nil {
+		log.Println("error while sending sendChatId", err)
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+)
+
+// dedupKey identifies notification delivered to chat
+type dedupKey struct {
+	chatID      int64
+	fingerprint string
+}
+
+type dedupEntry struct {
+	deliveredAt time.Time
+	// notifications received including the delivered one
+	count int
+	// first message of delivered notification, 0 when it was not sent right away
+	messageID int
+}
+
+// checkDuplicate reports whether the same notification was delivered to chat during
+// dedup_window. Duplicates of firing notifications are answered with "still firing"
+// reply when dedup_action is reply
+func (app *Application) checkDuplicate(alerts *Alerts, chatID int64, now time.Time) (dedupKey, bool) {
+	if app.config.DedupWindow.Duration <= 0 {
+		return dedupKey{}, false
+	}
+
+	key := dedupKey{chatID: chatID, fingerprint: alerts.Fingerprint()}
+
+	app.dedupMu.Lock()
+
+	for deliveredKey, entry := range app.delivered {
+		if now.Sub(entry.deliveredAt) >= app.config.DedupWindow.Duration {
+			delete(app.delivered, deliveredKey)
+		}
+	}
+
+	entry, ok := app.delivered[key]
+	if !ok {
+		app.delivered[key] = &dedupEntry{deliveredAt: now, count: 1}
+		app.dedupMu.Unlock()
+
+		return key, false
+	}
+
+	entry.count++
+	count, messageID := entry.count, entry.messageID
+
+	app.dedupMu.Unlock()
+
+	if app.config.Debug {
+		log.Println("Duplicate notification skipped:", chatID, key.fingerprint, count)
+	}
+
+	if app.config.DedupAction == appconfig.DedupActionReply && alerts.Status == "firing" && messageID != 0 {
+		text := fmt.Sprintf("🔁 Still firing (%v time)", ordinal(count))
+		app.SendPages(chatID, []*bytes.Buffer{bytes.NewBufferString(text)}, SendOptions{Silent: true, ReplyTo: messageID})
+	}
+
+	return key, true
+}
+
+// markDelivered remembers message of delivered notification. Notification which was
+// not sent is forgotten, so its next repeat is sent again
+func (app *Application) markDelivered(key dedupKey, messageIDs []int) {
+	if key.fingerprint == "" {
+		return
+	}
+
+	app.dedupMu.Lock()
+	defer app.dedupMu.Unlock()
+
+	if len(messageIDs) == 0 {
+		delete(app.delivered, key)
+		return
+	}
+
+	if entry, ok := app.delivered[key]; ok {
+		entry.messageID = messageIDs[0]
+	}
+}
+
+// ordinal formats number like 1st, 2nd, 3rd, 11th
+func ordinal(n int) string {
+	suffix := "th"
+
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+
+	return fmt.Sprintf("%d%v", n, suffix)
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+const (
+	digestCheckInterval = time.Minute
+	digestTopOffenders  = 5
+)
+
+type DigestCount struct {
+	Name  string
+	Count int
+}
+
+type DigestAlertCount struct {
+	Alert Alert
+	Count int
+}
+
+type DigestAck struct {
+	Alert   Alert
+	AckedBy string
+	AckedAt time.Time
+}
+
+// DigestView is data passed to digest templates
+type DigestView struct {
+	ChatID int64
+	// true when digest contains alerts held during quiet hours
+	Held bool
+	// true when digest contains alerts received while chat was muted
+	Muted bool
+	Since time.Time
+	Until time.Time
+	// count of received alert groups
+	Notifications int
+	// latest state of every alert
+	Alerts   []Alert
+	Firing   []Alert
+	Resolved []Alert
+	// firing alerts split by acknowledgement
+	Acked        []DigestAck
+	Unacked      []Alert
+	ByAlertName  []DigestCount
+	BySeverity   []DigestCount
+	TopOffenders []DigestAlertCount
+}
+
+func (app *Application) chatDigest(chatID int64) *appconfig.Digest {
+	if chatLayoutConfig, ok := app.config.ChatsLayouts[strconv.FormatInt(chatID, 10)]; ok {
+		return chatLayoutConfig.Digest
+	}
+
+	return nil
+}
+
+// bufferAlerts keeps alerts in state to deliver them later
+func (app *Application) bufferAlerts(buffer string, alerts *Alerts, chatID int64) error {
+	payload, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	return app.store.BufferAlerts(buffer, store.BufferedAlerts{ChatID: chatID, ReceivedAt: time.Now(), Payload: payload})
+}
+
+// sendDigests periodically sends digests to chats whose digest interval is over
+func (app *Application) sendDigests() {
+	app.every(digestCheckInterval, app.flushDigests)
+}
+
+// flushDigests sends digest to chat when interval boundary passed since the oldest buffered alert
+func (app *Application) flushDigests(now time.Time) {
+	chats, err := app.store.BufferedChats(store.DigestBuffer)
+	if err != nil {
+		log.Println("Error while reading digest alerts:", err)
+		return
+	}
+
+	for _, chat := range chats {
+		interval := time.Hour
+		if digest := app.chatDigest(chat.ChatID); digest != nil {
+			interval = digest.Interval.Duration
+		}
+
+		if !now.Truncate(interval).After(chat.Oldest) {
+			continue
+		}
+
+		buffered, err := app.store.TakeBuffered(store.DigestBuffer, chat.ChatID)
+		if err != nil {
+			log.Println("Error while taking digest alerts:", chat.ChatID, err)
+			continue
+		}
+
+		if app.keepUndelivered(store.DigestBuffer, buffered) {
+			return
+		}
+
+		app.sendDigest(chat.ChatID, app.buildDigest(buffered, now), SendOptions{})
+	}
+}
+
+// buildDigest summarizes buffered alert groups
+func (app *Application) buildDigest(buffered []store.BufferedAlerts, now time.Time) *DigestView {
+	view := &DigestView{
+		Until:    now,
+		Alerts:   make([]Alert, 0),
+		Firing:   make([]Alert, 0),
+		Resolved: make([]Alert, 0),
+		Acked:    make([]DigestAck, 0),
+		Unacked:  make([]Alert, 0),
+	}
+
+	if len(buffered) > 0 {
+		view.ChatID = buffered[0].ChatID
+		view.Since = buffered[0].ReceivedAt
+	}
+
+	indexes := make(map[string]int)
+	statuses := make([]string, 0)
+	counts := make([]int, 0)
+	byAlertName := make(map[string]int)
+	bySeverity := make(map[string]int)
+
+	for _, item := range buffered {
+		alerts := new(Alerts)
+		if err := json.Unmarshal(item.Payload, alerts); err != nil {
+			log.Println("Error while reading buffered alerts:", item.ChatID, err)
+			continue
+		}
+
+		view.Notifications++
+
+		for _, alert := range alerts.Alerts {
+			fingerprint := alert.ID()
+
+			idx, ok := indexes[fingerprint]
+			if !ok {
+				idx = len(view.Alerts)
+				indexes[fingerprint] = idx
+				view.Alerts = append(view.Alerts, alert)
+				statuses = append(statuses, "")
+				counts = append(counts, 0)
+			}
+
+			view.Alerts[idx] = alert
+			statuses[idx] = alert.Status
+			counts[idx]++
+
+			byAlertName[fmt.Sprint(alert.Labels["alertname"])]++
+			if severity, ok := alert.Labels[app.config.SeverityLabel]; ok {
+				bySeverity[strings.ToLower(fmt.Sprint(severity))]++
+			}
+		}
+	}
+
+	acks := make(map[string]store.Ack)
+	if app.store != nil {
+		if stored, err := app.store.Acks(); err == nil {
+			acks = stored
+		} else {
+			log.Println("Error while reading acks:", err)
+		}
+	}
+
+	for idx, alert := range view.Alerts {
+		if statuses[idx] == "resolved" {
+			view.Resolved = append(view.Resolved, alert)
+		} else {
+			view.Firing = append(view.Firing, alert)
+
+			if ack, ok := acks[alert.ID()]; ok {
+				view.Acked = append(view.Acked, DigestAck{Alert: alert, AckedBy: ack.AckedBy, AckedAt: ack.AckedAt})
+			} else {
+				view.Unacked = append(view.Unacked, alert)
+			}
+		}
+
+		view.TopOffenders = append(view.TopOffenders, DigestAlertCount{Alert: alert, Count: counts[idx]})
+	}
+
+	sort.SliceStable(view.TopOffenders, func(i, j int) bool {
+		return view.TopOffenders[i].Count > view.TopOffenders[j].Count
+	})
+
+	if len(view.TopOffenders) > digestTopOffenders {
+		view.TopOffenders = view.TopOffenders[:digestTopOffenders]
+	}
+
+	view.ByAlertName = sortedCounts(byAlertName)
+	view.BySeverity = sortedCounts(bySeverity)
+
+	return view
+}
+
+func sortedCounts(counts map[string]int) []DigestCount {
+	result := make([]DigestCount, 0, len(counts))
+	for name, count := range counts {
+		result = append(result, DigestCount{Name: name, Count: count})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+
+		return result[i].Name < result[j].Name
+	})
+
+	return result
+}
+
+// RenderDigest renders digest with chat digest template, long digests are split
+// to pages by lines
+func (app *Application) RenderDigest(view *DigestView, templateName string) ([]*bytes.Buffer, error) {
+	digestTemplate, err := textTemplate.New("Digest").Funcs(app.TextTemplateFuncMap()).Parse(app.config.DigestTemplates[templateName])
+	if err != nil {
+		return nil, fmt.Errorf("error while parsing digest template %v: %v", templateName, err)
+	}
+
+	rendered := new(bytes.Buffer)
+	if err := digestTemplate.Execute(rendered, view); err != nil {
+		return nil, fmt.Errorf("error while rendering digest template %v: %v", templateName, err)
+	}
+
+	pages := []*bytes.Buffer{new(bytes.Buffer)}
+
+	for _, line := range strings.SplitAfter(rendered.String(), "\n") {
+		page := pages[len(pages)-1]
+
+		if page.Len() > 0 && page.Len()+len(line) > app.config.SplitMessageBytes {
+			page = new(bytes.Buffer)
+			pages = append(pages, page)
+		}
+
+		page.WriteString(line)
+	}
+
+	return pages, nil
+}
+
+func (app *Application) sendDigest(chatID int64, view *DigestView, options SendOptions) {
+	templateName := "digest"
+	if digest := app.chatDigest(chatID); digest != nil {
+		templateName = digest.Template
+	}
+
+	pages, err := app.RenderDigest(view, templateName)
+	if err != nil {
+		log.Println("Error while rendering digest:", chatID, err)
+		return
+	}
+
+	app.SendPages(chatID, pages, options)
+}
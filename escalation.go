@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+const escalationCheckInterval = 30 * time.Second
+
+func (app *Application) escalationPolicy(name string) *appconfig.Escalation {
+	for idx := range app.config.Escalations {
+		if app.config.Escalations[idx].Name == name {
+			return &app.config.Escalations[idx]
+		}
+	}
+
+	return nil
+}
+
+// escalationApplies reports whether policy watches alerts sent to chat
+func escalationApplies(policy appconfig.Escalation, chatID int64) bool {
+	if len(policy.Chats) == 0 {
+		return true
+	}
+
+	for _, policyChatID := range policy.Chats {
+		if policyChatID == chatID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchEscalations returns escalation records for firing alerts matching escalation
+// policies of chat, nil when state is disabled
+func (app *Application) matchEscalations(alerts *Alerts, chatID int64, now time.Time) []*store.Escalation {
+	if app.store == nil {
+		return nil
+	}
+
+	var escalations []*store.Escalation
+
+	for _, policy := range app.config.Escalations {
+		if len(policy.Levels) == 0 || !escalationApplies(policy, chatID) {
+			continue
+		}
+
+		for _, alert := range alerts.Alerts {
+			if alert.IsResolved() || !policy.Matchers.Match(alert.StringLabels()) {
+				continue
+			}
+
+			payload, err := json.Marshal(alerts.WithAlerts([]Alert{alert}))
+			if err != nil {
+				log.Println("Error while saving escalation:", chatID, err)
+				continue
+			}
+
+			escalations = append(escalations, &store.Escalation{
+				Policy:      policy.Name,
+				Fingerprint: alert.ID(),
+				ChatID:      chatID,
+				StartedAt:   now,
+				NextAt:      now.Add(policy.Levels[0].After.Duration),
+				Payload:     payload,
+			})
+		}
+	}
+
+	return escalations
+}
+
+// trackEscalations saves escalation records of sent alerts. Timers of alerts
+// already waiting for acknowledgement are kept
+func (app *Application) trackEscalations(escalations []*store.Escalation, messageIDs []int) {
+	if len(escalations) == 0 || len(messageIDs) == 0 {
+		return
+	}
+
+	app.escalationsMu.Lock()
+	defer app.escalationsMu.Unlock()
+
+	for _, escalation := range escalations {
+		existing, err := app.store.Escalation(escalation.Key())
+		if err != nil {
+			log.Println("Error while reading escalation:", escalation.ChatID, err)
+			continue
+		}
+
+		if existing != nil {
+			existing.Payload = escalation.Payload
+			escalation = existing
+		}
+
+		if err := app.store.PutEscalation(escalation); err != nil {
+			log.Println("Error while saving escalation:", escalation.ChatID, err)
+		}
+	}
+}
+
+// closeEscalations stops escalation of resolved alerts and notifies chats alerts were escalated to
+func (app *Application) closeEscalations(alerts *Alerts, chatID int64) {
+	if app.store == nil {
+		return
+	}
+
+	// sending is slow, escalation state is not locked meanwhile
+	notify, notifyOrder := app.deleteResolvedEscalations(alerts, chatID)
+
+	for _, escalatedChatID := range notifyOrder {
+		header := fmt.Sprintf("⏬ <b>Escalated alerts resolved</b> in <code>%d</code>", chatID)
+		app.send(alerts.WithAlerts(notify[escalatedChatID]), escalatedChatID, SendOptions{Header: header, Escalated: true})
+	}
+}
+
+// deleteResolvedEscalations deletes escalations of resolved alerts of chat and returns
+// the alerts by chats they were escalated to
+func (app *Application) deleteResolvedEscalations(alerts *Alerts, chatID int64) (map[int64][]Alert, []int64) {
+	app.escalationsMu.Lock()
+	defer app.escalationsMu.Unlock()
+
+	resolved := make(map[string]Alert, len(alerts.Alerts))
+	for _, alert := range alerts.Resolved() {
+		resolved[alert.ID()] = alert
+	}
+
+	escalations, err := app.store.Escalations()
+	if err != nil {
+		log.Println("Error while reading escalations:", err)
+		return nil, nil
+	}
+
+	notify := make(map[int64][]Alert)
+	notifyOrder := make([]int64, 0)
+
+	for idx := range escalations {
+		escalation := &escalations[idx]
+
+		alert, ok := resolved[escalation.Fingerprint]
+		if !ok || escalation.ChatID != chatID {
+			continue
+		}
+
+		if err := app.store.DeleteEscalation(escalation); err != nil {
+			log.Println("Error while deleting escalation:", chatID, err)
+			continue
+		}
+
+		for _, escalatedChatID := range escalation.EscalatedChats {
+			if _, ok := notify[escalatedChatID]; !ok {
+				notifyOrder = append(notifyOrder, escalatedChatID)
+			}
+
+			notify[escalatedChatID] = append(notify[escalatedChatID], alert)
+		}
+	}
+
+	return notify, notifyOrder
+}
+
+// runEscalations periodically escalates alerts nobody acknowledged in time
+func (app *Application) runEscalations() {
+	app.every(escalationCheckInterval, app.escalate)
+}
+
+// escalationMessage is alerts of escalation level to be sent to level chats
+type escalationMessage struct {
+	alerts *Alerts
+	chats  []int64
+	header string
+}
+
+// escalate sends alerts whose escalation level is due to level chats. Alerts of the same
+// policy, source chat and level are sent together
+func (app *Application) escalate(now time.Time) {
+	// sending is slow, escalation state is not locked meanwhile
+	for _, message := range app.advanceEscalations(now) {
+		for _, levelChatID := range message.chats {
+			app.send(message.alerts, levelChatID, SendOptions{Header: message.header, Escalated: true})
+		}
+	}
+}
+
+// advanceEscalations moves escalations whose level is due to next level and returns
+// messages for chats of the level
+func (app *Application) advanceEscalations(now time.Time) []escalationMessage {
+	app.escalationsMu.Lock()
+	defer app.escalationsMu.Unlock()
+
+	escalations, err := app.store.Escalations()
+	if err != nil {
+		log.Println("Error while reading escalations:", err)
+		return nil
+	}
+
+	acks, err := app.store.Acks()
+	if err != nil {
+		log.Println("Error while reading acks:", err)
+		return nil
+	}
+
+	type groupKey struct {
+		policy string
+		chatID int64
+		level  int
+	}
+
+	messages := make([]escalationMessage, 0)
+	groups := make(map[groupKey][]*store.Escalation)
+	groupsOrder := make([]groupKey, 0)
+
+	for idx := range escalations {
+		escalation := &escalations[idx]
+		policy := app.escalationPolicy(escalation.Policy)
+
+		// policy removed from config or alert never resolved
+		if policy == nil || now.Sub(escalation.StartedAt) > app.config.HistoryRetention.Duration {
+			if err := app.store.DeleteEscalation(escalation); err != nil {
+				log.Println("Error while deleting escalation:", escalation.ChatID, err)
+			}
+
+			continue
+		}
+
+		if _, acked := acks[escalation.Fingerprint]; acked || escalation.NextAt.IsZero() || escalation.NextAt.After(now) || escalation.Level >= len(policy.Levels) {
+			continue
+		}
+
+		key := groupKey{policy: escalation.Policy, chatID: escalation.ChatID, level: escalation.Level}
+		if _, ok := groups[key]; !ok {
+			groupsOrder = append(groupsOrder, key)
+		}
+
+		groups[key] = append(groups[key], escalation)
+	}
+
+	for _, key := range groupsOrder {
+		policy := app.escalationPolicy(key.policy)
+		level := policy.Levels[key.level]
+
+		var alerts *Alerts
+		escalated := make([]Alert, 0, len(groups[key]))
+
+		for _, escalation := range groups[key] {
+			group := new(Alerts)
+			if err := json.Unmarshal(escalation.Payload, group); err != nil {
+				log.Println("Error while reading escalated alerts:", escalation.ChatID, err)
+				continue
+			}
+
+			if alerts == nil {
+				alerts = group
+			}
+
+			escalated = append(escalated, group.Alerts...)
+		}
+
+		if alerts == nil {
+			continue
+		}
+
+		alerts = alerts.WithAlerts(escalated)
+
+		header := fmt.Sprintf("⏫ <b>Escalation %v</b>: not acknowledged in <code>%d</code> for %v",
+			html.EscapeString(policy.Name), key.chatID, level.After.Duration)
+
+		messages = append(messages, escalationMessage{alerts: alerts, chats: level.Chats, header: header})
+
+		for _, escalation := range groups[key] {
+			escalation.EscalatedChats = append(escalation.EscalatedChats, level.Chats...)
+			escalation.Level++
+
+			if escalation.Level < len(policy.Levels) {
+				escalation.NextAt = escalation.StartedAt.Add(policy.Levels[escalation.Level].After.Duration)
+			} else {
+				escalation.NextAt = time.Time{}
+			}
+
+			if err := app.store.PutEscalation(escalation); err != nil {
+				log.Println("Error while saving escalation:", escalation.ChatID, err)
+			}
+		}
+	}
+
+	return messages
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/graph"
+	"github.com/pechorin/prometheus_tbot/pkg/prometheus"
+)
+
+// points per graph line, step of range query is range divided by it
+const graphPoints = 240
+
+// Telegram limits captions to 1024 characters, escaped expression takes up to this
+// and the rest is left for graph range and bounds
+const graphCaptionExprLimit = 800
+
+// rendered graph is reused for chats of notification during this time, failed render too,
+// so unreachable Prometheus delays notification once
+const graphCacheTTL = time.Minute
+
+type renderedGraph struct {
+	png        []byte
+	bounds     graph.Bounds
+	err        error
+	renderedAt time.Time
+}
+
+// alertExprs returns unique expressions of firing alerts from their generatorURL
+func alertExprs(alerts *Alerts, limit int) []string {
+	exprs := make([]string, 0, limit)
+	seen := make(map[string]bool)
+
+	for _, alert := range alerts.Firing() {
+		if len(exprs) >= limit {
+			break
+		}
+
+		expr := prometheus.ExprFromGeneratorURL(alert.GeneratorURL)
+		if expr == "" || seen[expr] {
+			continue
+		}
+
+		seen[expr] = true
+		exprs = append(exprs, expr)
+	}
+
+	return exprs
+}
+
+// sendGraphs replies to alert message with graphs of alert expressions. Graphs are optional,
+// errors are logged and message is left without graph
+func (app *Application) sendGraphs(alerts *Alerts, chatID int64, messageID int, now time.Time) {
+	if app.prometheus == nil {
+		return
+	}
+
+	for _, expr := range alertExprs(alerts, app.config.Graph.MaxGraphs) {
+		// graphs are optional, they are not waited during shutdown
+		if app.deliveriesAborted() {
+			return
+		}
+
+		rendered := app.cachedGraph(expr, now)
+		if rendered.err != nil {
+			log.Println("Error while rendering graph:", chatID, expr, rendered.err)
+			continue
+		}
+
+		bounds := rendered.bounds
+
+		photo := tgbotapi.NewPhotoUpload(chatID, tgbotapi.FileBytes{Name: "graph.png", Bytes: rendered.png})
+		photo.Caption = fmt.Sprintf("<code>%v</code>\n%v - %v, min %.4g, max %.4g",
+			escapeLimit(expr, graphCaptionExprLimit), app.formatTime(bounds.Start), app.formatTime(bounds.End), bounds.Min, bounds.Max)
+		photo.ParseMode = tgbotapi.ModeHTML
+		photo.ReplyToMessageID = messageID
+		photo.DisableNotification = true
+
+		if _, err := app.botSend(photo); err != nil {
+			log.Println("Error while sending graph:", chatID, err)
+			app.stats.MessageFailed(chatID, time.Now(), err)
+			continue
+		}
+
+		app.stats.MessageSent(chatID, time.Now())
+	}
+}
+
+// cachedGraph returns graph of expression rendered during graphCacheTTL before now,
+// or renders it. Notification sent to several chats queries Prometheus once
+func (app *Application) cachedGraph(expr string, now time.Time) renderedGraph {
+	app.graphsMu.Lock()
+	rendered, ok := app.graphs[expr]
+	app.graphsMu.Unlock()
+
+	if ok && now.Sub(rendered.renderedAt) < graphCacheTTL {
+		return rendered
+	}
+
+	rendered = renderedGraph{renderedAt: now}
+	rendered.png, rendered.bounds, rendered.err = app.renderGraph(expr, now)
+
+	app.graphsMu.Lock()
+	defer app.graphsMu.Unlock()
+
+	if app.graphs == nil {
+		app.graphs = make(map[string]renderedGraph)
+	}
+
+	for key, item := range app.graphs {
+		if now.Sub(item.renderedAt) >= graphCacheTTL {
+			delete(app.graphs, key)
+		}
+	}
+
+	app.graphs[expr] = rendered
+
+	return rendered
+}
+
+// renderGraph queries expression over graph range and draws it
+func (app *Application) renderGraph(expr string, now time.Time) ([]byte, graph.Bounds, error) {
+	graphRange := app.config.Graph.Range.Duration
+
+	step := graphRange / graphPoints
+	if step < time.Second {
+		step = time.Second
+	}
+
+	result, err := app.prometheus.QueryRange(expr, now.Add(-graphRange), now, step)
+	if err != nil {
+		return nil, graph.Bounds{}, err
+	}
+
+	series := make([]graph.Series, 0, len(result))
+	for _, item := range result {
+		points := make([]graph.Point, 0, len(item.Samples))
+		for _, sample := range item.Samples {
+			points = append(points, graph.Point{Time: sample.Time, Value: sample.Value})
+		}
+
+		series = append(series, graph.Series{Points: points})
+	}
+
+	return graph.Render(series, app.config.Graph.Width, app.config.Graph.Height)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// how often bots check Telegram with getMe
+	telegramCheckInterval = 30 * time.Second
+	// bot is not ready when Telegram did not answer for longer
+	telegramCheckMaxAge = 2 * time.Minute
+	// bot is not ready when more deliveries wait in queue
+	maxPendingDeliveries = 1000
+)
+
+// readinessCheck is one check of /-/ready
+type readinessCheck struct {
+	OK     bool        `json:"ok"`
+	Error  string      `json:"error,omitempty"`
+	Detail interface{} `json:"detail,omitempty"`
+}
+
+// checkTelegram periodically calls getMe to find out whether Telegram is reachable
+func (app *Application) checkTelegram() {
+	app.every(telegramCheckInterval, func(now time.Time) {
+		_, err := app.bot.GetMe()
+		app.telegramChecked(now, err)
+
+		if err != nil {
+			log.Println("Error while checking Telegram:", err)
+		}
+	})
+}
+
+func (app *Application) telegramChecked(now time.Time, err error) {
+	app.telegramMu.Lock()
+	defer app.telegramMu.Unlock()
+
+	app.telegramErr = err
+	if err == nil {
+		app.telegramOKAt = now
+	}
+}
+
+// HTTPHealthyHandler answers while process is alive
+func (app *Application) HTTPHealthyHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "healthy"})
+}
+
+// HTTPReadyHandler answers 200 when bot can deliver alerts and 503 with failed checks otherwise
+func (app *Application) HTTPReadyHandler(c *gin.Context) {
+	checks := app.readinessChecks(time.Now())
+
+	code, status := http.StatusOK, "ready"
+	for _, check := range checks {
+		if !check.OK {
+			code, status = http.StatusServiceUnavailable, "not ready"
+		}
+	}
+
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+func (app *Application) readinessChecks(now time.Time) map[string]readinessCheck {
+	snapshot := app.stats.Snapshot()
+
+	checks := map[string]readinessCheck{
+		"config": {OK: true, Detail: gin.H{"loaded_at": snapshot.ConfigLoadedAt}},
+		"queue": {
+			OK:     snapshot.Pending < maxPendingDeliveries,
+			Detail: gin.H{"pending": snapshot.Pending, "limit": maxPendingDeliveries},
+		},
+	}
+
+	bots := []*Application{app}
+	names := make([]string, 0, len(app.bots))
+	for name := range app.bots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		bots = append(bots, app.bots[name])
+	}
+
+	for idx, bot := range bots {
+		suffix := ""
+		if idx > 0 {
+			suffix = "." + names[idx-1]
+		}
+
+		checks["templates"+suffix] = bot.templatesCheck()
+		checks["telegram"+suffix] = bot.telegramCheck(now)
+
+		// state and watchdogs are held by leader, standby replica without spool answers webhooks with 503
+		if bot.forwardsWebhooks() && bot.spool == nil {
+			checks["cluster"+suffix] = readinessCheck{Error: "standby replica, state and watchdogs are held by cluster leader"}
+		}
+	}
+
+	return checks
+}
+
+// templatesCheck compiles layouts and templates of bot
+func (app *Application) templatesCheck() readinessCheck {
+	groups := []struct {
+		key       string
+		templates map[string]string
+	}{
+		{"layouts", app.config.Layouts},
+		{"message_templates", app.config.MessageTemplates},
+		{"digest_templates", app.config.DigestTemplates},
+	}
+
+	for _, group := range groups {
+		for name, text := range group.templates {
+			if _, err := textTemplate.New(name).Funcs(app.TextTemplateFuncMap()).Parse(text); err != nil {
+				return readinessCheck{Error: fmt.Sprintf("%v.%v: %v", group.key, name, err)}
+			}
+		}
+	}
+
+	return readinessCheck{OK: true}
+}
+
+func (app *Application) telegramCheck(now time.Time) readinessCheck {
+	app.telegramMu.Lock()
+	okAt, err := app.telegramOKAt, app.telegramErr
+	app.telegramMu.Unlock()
+
+	check := readinessCheck{OK: !okAt.IsZero() && now.Sub(okAt) < telegramCheckMaxAge}
+	if !okAt.IsZero() {
+		check.Detail = gin.H{"last_success": okAt}
+	}
+
+	switch {
+	case err != nil:
+		check.Error = err.Error()
+	case okAt.IsZero():
+		check.Error = "bot is not connected to Telegram"
+	case !check.OK:
+		check.Error = "Telegram did not answer since " + okAt.Format(time.RFC3339)
+	}
+
+	return check
+}
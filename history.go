@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+const defaultHistoryPeriod = 24 * time.Hour
+
+// recordHistory saves every alert delivered to chat, does nothing when state is disabled
+func (app *Application) recordHistory(alerts *Alerts, chatID int64, messageIDs []int) {
+	if app.store == nil || len(messageIDs) == 0 {
+		return
+	}
+
+	now := time.Now()
+	notifications := make([]store.Notification, 0, len(alerts.Alerts))
+
+	for _, alert := range alerts.Alerts {
+		labels := alert.StringLabels()
+
+		notifications = append(notifications, store.Notification{
+			Fingerprint: alert.ID(),
+			AlertName:   labels["alertname"],
+			Labels:      labels,
+			Status:      alert.Status,
+			StartsAt:    alert.StartsAtTime(),
+			EndsAt:      alert.EndsAtTime(),
+			Receiver:    alerts.Receiver,
+			GroupKey:    alerts.GroupKey,
+			ChatID:      chatID,
+			MessageIDs:  messageIDs,
+			SentAt:      now,
+		})
+	}
+
+	if err := app.store.AddNotifications(notifications); err != nil {
+		log.Println("Error while saving history:", chatID, err)
+	}
+}
+
+func (app *Application) pruneHistory() {
+	prune := func(now time.Time) {
+		removed, err := app.store.PruneHistory(now.Add(-app.config.HistoryRetention.Duration))
+		if err != nil {
+			log.Println("Error while pruning history:", err)
+		} else if app.config.Debug {
+			log.Println("History pruned, removed notifications:", removed)
+		}
+	}
+
+	prune(time.Now())
+	app.every(time.Hour, prune)
+}
+
+// parseHistoryArgs parses "[alertname] [period]" in any order
+func parseHistoryArgs(args []string) (alertName string, period time.Duration) {
+	period = defaultHistoryPeriod
+
+	for _, arg := range args {
+		if parsed, err := appconfig.ParseDuration(arg); err == nil && parsed > 0 {
+			period = parsed
+		} else {
+			alertName = arg
+		}
+	}
+
+	return
+}
+
+type historySummary struct {
+	AlertName string    `json:"alertname"`
+	Fired     int       `json:"fired"`
+	Resolved  int       `json:"resolved"`
+	LastSent  time.Time `json:"lastSent"`
+}
+
+// summarizeHistory counts firing and resolved episodes per alertname, repeated
+// notifications of the same alert episode are counted once
+func summarizeHistory(notifications []store.Notification) []*historySummary {
+	byName := make(map[string]*historySummary)
+	seen := make(map[string]bool)
+
+	for _, n := range notifications {
+		summary, ok := byName[n.AlertName]
+		if !ok {
+			summary = &historySummary{AlertName: n.AlertName}
+			byName[n.AlertName] = summary
+		}
+
+		if n.SentAt.After(summary.LastSent) {
+			summary.LastSent = n.SentAt
+		}
+
+		episode := n.Status + "/" + n.Fingerprint + "/" + n.StartsAt.String()
+		if seen[episode] {
+			continue
+		}
+		seen[episode] = true
+
+		if n.Status == "resolved" {
+			summary.Resolved++
+		} else {
+			summary.Fired++
+		}
+	}
+
+	result := make([]*historySummary, 0, len(byName))
+	for _, summary := range byName {
+		result = append(result, summary)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Fired != result[j].Fired {
+			return result[i].Fired > result[j].Fired
+		}
+
+		return result[i].AlertName < result[j].AlertName
+	})
+
+	return result
+}
+
+func (app *Application) location() *time.Location {
+	if app.config.TimeZone != "" {
+		if loc, err := time.LoadLocation(app.config.TimeZone); err == nil {
+			return loc
+		}
+	}
+
+	return time.UTC
+}
+
+// historyCommand answers /history [alertname] [period] with alerts delivered to the chat
+func (app *Application) historyCommand(message *tgbotapi.Message, args []string) {
+	text := new(bytes.Buffer)
+
+	alertName, period := parseHistoryArgs(args)
+
+	if app.store == nil {
+		text.WriteString("History is disabled, set <code>state_path</code> in config")
+	} else {
+		notifications, err := app.store.History(store.HistoryFilter{
+			AlertName: alertName,
+			ChatID:    message.Chat.ID,
+			Since:     time.Now().Add(-period),
+		})
+
+		if err != nil {
+			log.Println("Error while reading history:", err)
+			text.WriteString("Cannot read history")
+		} else {
+			fmt.Fprintf(text, "<b>History for last %v</b>", period)
+			if alertName != "" {
+				fmt.Fprintf(text, " <code>%v</code>", html.EscapeString(alertName))
+			}
+			text.WriteString("\n")
+
+			summaries := summarizeHistory(notifications)
+			if len(summaries) == 0 {
+				text.WriteString("\nNo alerts")
+			}
+
+			for _, summary := range summaries {
+				fmt.Fprintf(text, "\n<code>%v</code>: fired %d, resolved %d, last at %v",
+					html.EscapeString(summary.AlertName), summary.Fired, summary.Resolved,
+					summary.LastSent.In(app.location()).Format("2006-01-02 15:04"))
+			}
+		}
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, text.String())
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyToMessageID = message.MessageID
+
+	if _, err := app.botSend(msg); err != nil {
+		log.Println("error while sending history", err)
+	}
+}
+
+// HTTPHistoryHandler returns delivered notifications.
+//
+// Query params:
+//   alertname - filter by alert name
+//   chat_id   - filter by chat
+//   since     - period to look back, default 24h
+//   limit     - max notifications count
+func (app *Application) HTTPHistoryHandler(c *gin.Context) {
+	// state is opened by lead when replica becomes leader
+	if app.isStandby() && app.config.StatePath != "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"desc": "standby replica, history is held by cluster leader"})
+		return
+	}
+
+	if app.store == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"desc": "history is disabled, set state_path in config"})
+		return
+	}
+
+	filter := store.HistoryFilter{AlertName: c.Query("alertname")}
+
+	period := defaultHistoryPeriod
+	if since := c.Query("since"); since != "" {
+		parsed, err := appconfig.ParseDuration(since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": "invalid since", "errstr": err.Error()})
+			return
+		}
+
+		period = parsed
+	}
+	filter.Since = time.Now().Add(-period)
+
+	if chatID := c.Query("chat_id"); chatID != "" {
+		parsed, err := strconv.ParseInt(chatID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": "invalid chat_id", "errstr": err.Error()})
+			return
+		}
+
+		filter.ChatID = parsed
+	}
+
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": "invalid limit", "errstr": err.Error()})
+			return
+		}
+
+		filter.Limit = parsed
+	}
+
+	notifications, err := app.store.History(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"desc": "cannot read history", "errstr": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"notifications": notifications,
+		"summary":       summarizeHistory(notifications),
+	})
+}
@@ -2,23 +2,35 @@ package main // import "github.com/pechorin/prometheus_tbot"
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"html/template"
 	"os"
 	"time"
 
 	"fmt"
+	"hash/fnv"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/gin-gonic/gin"
 	"gopkg.in/telegram-bot-api.v4"
 
 	textTemplate "text/template"
 
+	"github.com/pechorin/prometheus_tbot/pkg/alertmanager"
 	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/cluster"
 	"github.com/pechorin/prometheus_tbot/pkg/measureconv"
+	"github.com/pechorin/prometheus_tbot/pkg/prometheus"
+	"github.com/pechorin/prometheus_tbot/pkg/recorder"
+	"github.com/pechorin/prometheus_tbot/pkg/runbook"
+	"github.com/pechorin/prometheus_tbot/pkg/stats"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
 )
 
 type Alerts struct {
@@ -33,89 +45,358 @@ type Alerts struct {
 	Version           string                 `json:"version"`
 }
 
+// UnmarshalJSON fills status of alerts from group status for payloads without per alert status
+func (alerts *Alerts) UnmarshalJSON(data []byte) error {
+	type plain Alerts
+	if err := json.Unmarshal(data, (*plain)(alerts)); err != nil {
+		return err
+	}
+
+	for idx := range alerts.Alerts {
+		if alerts.Alerts[idx].Status == "" {
+			alerts.Alerts[idx].Status = alerts.Status
+		}
+	}
+
+	return nil
+}
+
+// Firing returns firing alerts of group, group with firing status may contain resolved alerts
+func (alerts *Alerts) Firing() []Alert {
+	firing := make([]Alert, 0, len(alerts.Alerts))
+	for _, alert := range alerts.Alerts {
+		if !alert.IsResolved() {
+			firing = append(firing, alert)
+		}
+	}
+
+	return firing
+}
+
+// Resolved returns resolved alerts of group
+func (alerts *Alerts) Resolved() []Alert {
+	resolved := make([]Alert, 0, len(alerts.Alerts))
+	for _, alert := range alerts.Alerts {
+		if alert.IsResolved() {
+			resolved = append(resolved, alert)
+		}
+	}
+
+	return resolved
+}
+
 type Alert struct {
 	Annotations  map[string]interface{} `json:"annotations"`
 	EndsAt       string                 `json:"endsAt"`
 	GeneratorURL string                 `json:"generatorURL"`
 	Labels       map[string]interface{} `json:"labels"`
 	StartsAt     string                 `json:"startsAt"`
+	Status       string                 `json:"status"`
+	// Alertmanager fingerprint, empty in payloads of old Alertmanager versions
+	Fingerprint string `json:"fingerprint"`
+}
+
+func (alert Alert) IsResolved() bool {
+	return alert.Status == "resolved"
+}
+
+// StartsAtTime returns parsed startsAt, zero time when it is empty or invalid
+func (alert Alert) StartsAtTime() time.Time {
+	return parseAlertTime(alert.StartsAt)
+}
+
+// EndsAtTime returns parsed endsAt, zero time when it is empty or invalid
+func (alert Alert) EndsAtTime() time.Time {
+	return parseAlertTime(alert.EndsAt)
+}
+
+func parseAlertTime(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return t
+}
+
+// Duration returns how long alert is firing, for resolved alert how long it was firing
+func (alert Alert) Duration() time.Duration {
+	startsAt := alert.StartsAtTime()
+	if startsAt.IsZero() {
+		return 0
+	}
+
+	end := time.Now()
+	if endsAt := alert.EndsAtTime(); alert.IsResolved() && !endsAt.IsZero() {
+		end = endsAt
+	}
+
+	return end.Sub(startsAt).Round(time.Second)
+}
+
+// ID identifies alert in state, it is Alertmanager fingerprint so acks and history match
+// alerts in Alertmanager. Payloads of old Alertmanager versions get fingerprint of labels
+func (alert Alert) ID() string {
+	if alert.Fingerprint != "" {
+		return alert.Fingerprint
+	}
+
+	return alert.LabelsFingerprint()
+}
+
+// LabelsFingerprint identifies alert by its labels, like Alertmanager fingerprint does
+func (alert Alert) LabelsFingerprint() string {
+	names := make([]string, 0, len(alert.Labels))
+	for name := range alert.Labels {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	hash := fnv.New64a()
+	for _, name := range names {
+		hash.Write([]byte(name))
+		hash.Write([]byte{0xff})
+		hash.Write([]byte(fmt.Sprint(alert.Labels[name])))
+		hash.Write([]byte{0xff})
+	}
+
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
+
+// EpisodeFingerprint identifies one firing of alert, alert firing again gets new startsAt
+func (alert Alert) EpisodeFingerprint() string {
+	hash := fnv.New64a()
+	hash.Write([]byte(alert.ID()))
+	hash.Write([]byte{0xff})
+	hash.Write([]byte(alert.StartsAtTime().UTC().Format(time.RFC3339Nano)))
+
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
+
+// StringLabels returns alert labels with values formatted as strings
+func (alert Alert) StringLabels() map[string]string {
+	labels := make(map[string]string, len(alert.Labels))
+	for name, value := range alert.Labels {
+		labels[name] = fmt.Sprint(value)
+	}
+
+	return labels
+}
+
+// Fingerprint identifies notification by its status and alerts, order of alerts does not matter
+func (alerts *Alerts) Fingerprint() string {
+	fingerprints := make([]string, 0, len(alerts.Alerts))
+	for _, alert := range alerts.Alerts {
+		fingerprints = append(fingerprints, alert.EpisodeFingerprint())
+	}
+
+	sort.Strings(fingerprints)
+
+	hash := fnv.New64a()
+	hash.Write([]byte(alerts.Status))
+	for _, fingerprint := range fingerprints {
+		hash.Write([]byte{0xff})
+		hash.Write([]byte(fingerprint))
+	}
+
+	return fmt.Sprintf("%016x", hash.Sum64())
+}
+
+// WithAlerts returns copy of alerts group containing only given alerts
+func (alerts *Alerts) WithAlerts(subset []Alert) *Alerts {
+	group := *alerts
+	group.Alerts = subset
+
+	return &group
 }
 
 type PrometheusAlertsView struct {
 	PageNumber 	   			int
 	PageMessages   			[]*bytes.Buffer
 	Alerts  	   			*Alerts // TODO: rename to AlertsJson / AlertsData ?
+	Firing  	   			[]Alert
+	Resolved  	   			[]Alert
 }
 
 type Application struct {
 	config           	*appconfig.Config
 	bot              	*tgbotapi.BotAPI
 	measureConverter 	*measureconv.Converter
+	recorder         	*recorder.Recorder
+	store            	*store.Store
+	alertmanager     	*alertmanager.Client
+	prometheus       	*prometheus.Client
+	runbooks         	*runbook.Fetcher
+	// graphs rendered for recent notifications by expression
+	graphsMu         	sync.Mutex
+	graphs           	map[string]renderedGraph
+	stats            	*stats.Stats
+
+	// in-flight alert deliveries started by HTTPAlertHandler
+	deliveries       	sync.WaitGroup
+	// guards read-modify-write of escalation state
+	escalationsMu    	sync.Mutex
+	// notifications delivered during dedup_window
+	delivered        	map[dedupKey]*dedupEntry
+	dedupMu          	sync.Mutex
+	// heartbeat state by receiver
+	watchdogs        	map[string]*watchdogState
+	watchdogsMu      	sync.Mutex
+	// additional bots by name, see appconfig.Bot
+	bots             	map[string]*Application
+	limiter          	*rateLimiter
+	// canceled when shutdown starts, stops background jobs and Telegram updates
+	ctx              	context.Context
+	stop             	context.CancelFunc
+	// canceled when in-flight deliveries are not finished during shutdown_timeout
+	deliveryCtx      	context.Context
+	abortDeliveries  	context.CancelFunc
+	// background jobs started by lead and connect
+	jobs             	sync.WaitGroup
+	// bot name from config, empty for main bot
+	name             	string
+	// set while other replica of cluster is leader
+	standby          	int32
+	claims           	cluster.Claims
+	spool            	*cluster.Spool
+	// last successful getMe, see checkTelegram
+	telegramOKAt     	time.Time
+	telegramErr      	error
+	telegramMu       	sync.Mutex
 }
 
 func NewApplication() *Application {
+	return NewApplicationWithConfig(appconfig.New())
+}
+
+func NewApplicationWithConfig(config *appconfig.Config) *Application {
 	app := new(Application)
-	app.config = appconfig.New()
+	app.config = config
 	app.measureConverter = &measureconv.Converter{Config: app.config}
+	app.stats = stats.New(time.Now())
+	if !config.LoadedAt.IsZero() {
+		app.stats.ConfigLoaded(config.LoadedAt)
+	}
+	app.watchdogs = make(map[string]*watchdogState)
+	app.delivered = make(map[dedupKey]*dedupEntry)
+	app.limiter = newRateLimiter(app.config.SendRate)
+	app.ctx, app.stop = context.WithCancel(context.Background())
+	app.deliveryCtx, app.abortDeliveries = context.WithCancel(context.Background())
+
+	if app.config.RecordPath != "" {
+		app.recorder = recorder.New(app.config.RecordPath)
+	}
+
+	if app.config.AlertmanagerURL != "" {
+		app.alertmanager = alertmanager.New(app.config.AlertmanagerURL)
+	}
+
+	if app.config.Graph != nil && app.config.Graph.PrometheusURL != "" {
+		app.prometheus = prometheus.New(app.config.Graph.PrometheusURL)
+	}
+
+	if app.config.Runbooks != nil {
+		app.runbooks = runbook.New(app.config.Runbooks.Sources, app.config.Runbooks.CacheTTL.Duration)
+	}
+
+	app.bots = app.newBots()
 
 	return app
 }
 
 func main() {
-	app := NewApplication()
-
-	botTmp, err := tgbotapi.NewBotAPI(app.config.TelegramToken)
-	if err != nil {
-		fmt.Println("cant start bot with token: " + app.config.TelegramToken)
-		log.Fatal(err)
+	if len(os.Args) > 1 {
+		if command, ok := subcommands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
 	}
 
-	app.bot = botTmp
+	app := NewApplication()
 
-	if app.config.Debug {
-		app.bot.Debug = true
-		log.Printf("Authorised on account %s", app.bot.Self.UserName)
+	if errs := app.validateConfig(); len(errs) > 0 {
+		for _, err := range errs {
+			log.Println("Config error:", err)
+		}
+
+		log.Fatalf("%d config problem(s) found, check config with check-config subcommand", len(errs))
 	}
 
 	if !(app.config.Debug) {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	go app.telegramBot(app.bot)
+	app.start()
 
 	router := gin.Default()
+	router.POST("/alert", app.HTTPAlertHandler)
 	router.POST("/alert/*chatids", app.HTTPAlertHandler)
-	router.Run(app.config.Port)
+	router.POST("/api/v1/preview", app.HTTPPreviewHandler)
+	router.GET("/api/v1/history", app.HTTPHistoryHandler)
+	router.GET("/metrics", app.HTTPMetricsHandler)
+	router.GET("/-/healthy", app.HTTPHealthyHandler)
+	router.GET("/-/ready", app.HTTPReadyHandler)
+	app.routeTelegramWebhooks(router)
+
+	server := &http.Server{Addr: app.config.Port, Handler: router}
+
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
 
 	startStr := fmt.Sprintf("Prometheus Tbot started at port %v", app.config.Port)
 	os.Stdout.WriteString(startStr)
+
+	app.waitShutdown(server)
 }
 
 func (app *Application) telegramBot(bot *tgbotapi.BotAPI) {
 	u := tgbotapi.NewUpdate(0)
 	u.Timeout = 60
 
+	// getUpdates does not work while webhook is set, e.g. after switching from webhook mode
+	if _, err := bot.RemoveWebhook(); err != nil {
+		log.Println("Error while removing webhook:", err)
+	}
+
 	updates, err := bot.GetUpdatesChan(u)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sendChatId := func(update tgbotapi.Update) {
-		msg := tgbotapi.NewMessage(update.Message.Chat.ID, fmt.Sprintf("Chat id is '%d'", update.Message.Chat.ID))
-		if _, err := app.bot.Send(msg); err != nil {
-			log.Println("error while sending sendChatId", err)
+	for {
+		select {
+		case <-app.ctx.Done():
+			bot.StopReceivingUpdates()
+			return
+		case update := <-updates:
+			app.handleUpdate(update)
 		}
 	}
+}
 
-	for update := range updates {
-		if update.Message != nil {
-			switch update.Message.Text {
-			case "/chatID", "/chatid", "/chatId":
-				sendChatId(update)
-			default:
-				continue
-			}
-		}
+func (app *Application) handleUpdate(update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		app.callbackQuery(update.CallbackQuery)
+		return
+	}
+
+	if update.Message != nil {
+		app.dispatchCommand(update.Message)
+	}
+}
+
+// replyText answers message with HTML text, keyboard can be nil
+func (app *Application) replyText(message *tgbotapi.Message, text string, keyboard interface{}) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, text)
+	msg.ParseMode = tgbotapi.ModeHTML
+	msg.ReplyToMessageID = message.MessageID
+	msg.ReplyMarkup = keyboard
+
+	if _, err := app.botSend(msg); err != nil {
+		log.Println("Error while sending reply:", message.Chat.ID, err)
 	}
 }
 
@@ -144,11 +425,20 @@ func (app *Application) parseMultiParam(s string, c *gin.Context) []int64 {
 }
 
 func (app *Application) HTTPAlertHandler(c *gin.Context) {
-	chatIds := app.parseMultiParam(c.Param("chatids"), c)
+	bot, chatIDsPath := app.alertBot(c.Param("chatids"))
+	bot.handleAlerts(c, chatIDsPath)
+}
+
+// handleAlerts delivers webhook to chats listed in path or subscribed to alerts
+func (app *Application) handleAlerts(c *gin.Context, chatIDsPath string) {
+	chatIds := app.parseMultiParam(chatIDsPath, c)
+
+	// without the check a typo in receiver URL routes alerts only to subscriptions
+	if len(chatIds) == 0 && strings.Trim(chatIDsPath, "/") != "" {
+		app.stats.WebhookRejected()
 
-	if len(chatIds) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{
-			"desc": "no chats provided",
+			"desc": "invalid chat ids in URL",
 		})
 
 		return
@@ -156,7 +446,14 @@ func (app *Application) HTTPAlertHandler(c *gin.Context) {
 
 	alerts := new(Alerts)
 
-	if err := c.ShouldBindJSON(alerts); err != nil {
+	payload, err := c.GetRawData()
+	if err == nil {
+		err = json.Unmarshal(payload, alerts)
+	}
+
+	if err != nil {
+		app.stats.WebhookRejected()
+
 		c.JSON(http.StatusBadRequest, gin.H{
 			"err":    err,
 			"info":   "alerts data invalid",
@@ -167,17 +464,86 @@ func (app *Application) HTTPAlertHandler(c *gin.Context) {
 		return
 	}
 
-	bufferCh := make(chan int64, len(chatIds))
+	if app.recorder != nil {
+		if err := app.recorder.Append(recorder.NewRecord(app.name, c.Request.URL.Path, chatIds, payload)); err != nil {
+			log.Println("Error while recording webhook:", err)
+		}
+	}
+
+	// state and watchdogs are held by leader, webhook is passed to leader through spool
+	// or retried by Alertmanager
+	if app.forwardsWebhooks() {
+		app.spoolWebhook(c, alerts, chatIds, payload)
+		return
+	}
+
+	status, message := app.acceptAlerts(c.Request.URL.Path, alerts, chatIds)
+	if status != http.StatusOK {
+		c.JSON(status, gin.H{"desc": message})
+		return
+	}
+
+	c.String(status, message)
+}
+
+// acceptAlerts handles heartbeats and starts delivery of alerts, path identifies webhook
+// for notification claims. Returns HTTP status and message for Alertmanager
+func (app *Application) acceptAlerts(path string, alerts *Alerts, chatIds []int64) (int, string) {
+	now := time.Now()
+	receiver := alerts.Receiver
+
+	alerts, heartbeat := app.splitHeartbeats(alerts, now)
+	if heartbeat {
+		app.heartbeat(receiver, now)
+	}
+
+	if alerts == nil {
+		app.stats.WebhookAccepted(receiver, now)
+
+		return http.StatusOK, "OK, heartbeat received"
+	}
+
+	// without state there are no subscriptions to route alerts
+	if len(chatIds) == 0 && app.store == nil {
+		app.stats.WebhookRejected()
+
+		return http.StatusBadRequest, "no chats provided"
+	}
+
+	app.stats.WebhookAccepted(receiver, now)
+
+	if !app.claimNotification(path, alerts) {
+		return http.StatusOK, "OK, delivered by other replica"
+	}
+
+	routes := app.routeAlerts(alerts, chatIds)
+	app.stats.AddPending(int64(len(routes)))
+
+	bufferCh := make(chan routedAlerts, len(routes))
+
+	app.deliveries.Add(1)
 
 	go func() {
+		defer app.deliveries.Done()
+
+		app.clearAcks(alerts)
+
 		//defer func() {
 		//	if err := recover(); err != nil {
 		//		log.Printf("Panic handled while sending message: %v", err)
 		//	}
 		//}()
 
-		for chatID := range bufferCh {
-			if chatID == 0 {
+		for route := range bufferCh {
+			app.stats.AddPending(-1)
+
+			// drain timeout is over, rest of routes is delivered after restart
+			if app.deliveriesAborted() {
+				app.saveUndelivered(route)
+				continue
+			}
+
+			if route.chatID == 0 {
 				if app.config.Debug {
 					log.Println("Skip for 0 chatID")
 				}
@@ -185,59 +551,155 @@ func (app *Application) HTTPAlertHandler(c *gin.Context) {
 				continue
 			}
 
-			// default render values
-			selectedLayout := appconfig.SelectedLayout{ Layout: "prometheus", MessageTemplate: "prometheus", GroupByAlertName: true }
+			app.deliver(route.alerts, route.chatID)
+		}
+	}()
 
-			chatIDStr := strconv.FormatInt(chatID, 10)
+	for _, route := range routes {
+		if app.config.Debug {
+			log.Println("Sending chat-id", route.chatID)
+		}
 
-			if chatLayoutConfig, ok := app.config.ChatsLayouts[chatIDStr]; ok == true {
-				if newLayout, ok := chatLayoutConfig["layout"]; ok == true {
-					selectedLayout.Layout = newLayout
-				}
+		bufferCh <- route
+	}
 
-				if newMessageTemplate, ok := chatLayoutConfig["message_template"]; ok == true {
-					selectedLayout.MessageTemplate = newMessageTemplate
-				}
-			}
+	close(bufferCh)
 
-			// currently where are 2 rendering types for Prometheus: with and without grouping
-			sendBuffers := make([]*bytes.Buffer, 0)
+	return http.StatusOK, fmt.Sprintf("OK, delivered for %d chats", len(routes))
+}
 
-			if selectedLayout.GroupByAlertName == true {
-				sendBuffers = app.RenderPrometheusAlertsWithGrouping(alerts, selectedLayout)
-			} else {
-				sendBuffers = app.RenderPrometheusAlerts(alerts, selectedLayout)
-			}
+// deliver sends alerts to chat. Alerts muted in chat are dropped or saved for summary,
+// alerts for chats with digest are saved until next digest, alerts arrived during chat
+// quiet hours are handled according to chat schedule
+func (app *Application) deliver(alerts *Alerts, chatID int64) {
+	key, duplicate := app.checkDuplicate(alerts, chatID, time.Now())
+	if duplicate {
+		return
+	}
 
-			for idx, buffer := range sendBuffers {
-				if buffer.Len() > 0 {
-					if idx > 0 {
-						time.Sleep(3) // delay before second message
-					}
+	alerts, muted := app.splitMutedAlerts(alerts, chatID, time.Now())
 
-					msg := tgbotapi.NewMessage(chatID, buffer.String())
-					msg.ParseMode = "HTML"
+	if muted != nil {
+		app.handleMutedAlerts(muted, chatID)
+	}
 
-					if _, err := app.bot.Send(msg); err != nil {
-						log.Println("Error while sending message:", chatID ,err)
-					}
-				}
-			}
+	if alerts == nil {
+		return
+	}
 
+	if app.chatDigest(chatID) != nil && app.store != nil {
+		if err := app.bufferAlerts(store.DigestBuffer, alerts, chatID); err == nil {
+			return
+		} else {
+			log.Println("Error while saving alerts for digest, sending now:", chatID, err)
 		}
-	}()
+	}
 
-	for _, chatID := range chatIds {
-		if app.config.Debug {
-			log.Println("Sending chat-id", chatID)
-		}
+	notify, quiet := app.splitQuietAlerts(alerts, chatID, time.Now())
 
-		bufferCh <- chatID
+	if notify != nil {
+		app.markDelivered(key, app.send(notify, chatID, SendOptions{}))
 	}
 
-	close(bufferCh)
+	if quiet != nil {
+		app.handleQuietAlerts(quiet, chatID)
+	}
+}
+
+// send renders alerts with chat layout, sends them and saves to history. Returns ids of sent messages
+func (app *Application) send(alerts *Alerts, chatID int64, options SendOptions) []int {
+	pages, err := app.RenderAlerts(alerts, app.SelectLayout(chatID))
+	if err != nil {
+		log.Println("Error while rendering alerts:", chatID, err)
+		return nil
+	}
+
+	if options.ReplyMarkup == nil {
+		options.ReplyMarkup = app.alertsKeyboard(alerts)
+	}
+
+	var escalations []*store.Escalation
+	if !options.Escalated {
+		escalations = app.matchEscalations(alerts, chatID, time.Now())
+	}
+
+	messageIDs := app.SendPages(chatID, pages, options)
+
+	app.recordHistory(alerts, chatID, messageIDs)
+
+	if len(messageIDs) > 0 {
+		app.sendRunbooks(alerts, chatID, messageIDs[0], time.Now())
+		app.sendGraphs(alerts, chatID, messageIDs[0], time.Now())
+	}
+	app.trackEscalations(escalations, messageIDs)
+
+	if !options.Escalated && len(alerts.Resolved()) > 0 {
+		app.closeEscalations(alerts, chatID)
+	}
+
+	return messageIDs
+}
+
+type SendOptions struct {
+	// send messages without notification sound
+	Silent bool
+	// text added before the first page
+	Header string
+	// keyboard attached to the last page
+	ReplyMarkup interface{}
+	// message replied by the first page
+	ReplyTo int
+	// alerts are escalated from another chat and are not tracked for escalation again
+	Escalated bool
+}
+
+// SendPages sends rendered pages to chat one by one and returns ids of sent messages
+func (app *Application) SendPages(chatID int64, pages []*bytes.Buffer, options SendOptions) []int {
+	messageIDs := make([]int, 0, len(pages))
 
-	c.String(http.StatusOK, "OK, delivered for", len(chatIds), "chats")
+	lastPage := -1
+	for idx, buffer := range pages {
+		if buffer.Len() > 0 {
+			lastPage = idx
+		}
+	}
+
+	for idx, buffer := range pages {
+		if buffer.Len() > 0 {
+			if idx > 0 {
+				time.Sleep(3) // delay before second message
+			}
+
+			text := buffer.String()
+			if idx == 0 && options.Header != "" {
+				text = options.Header + "\n" + text
+			}
+
+			msg := tgbotapi.NewMessage(chatID, text)
+			msg.ParseMode = "HTML"
+			msg.DisableNotification = options.Silent
+
+			if idx == 0 {
+				msg.ReplyToMessageID = options.ReplyTo
+			}
+
+			if idx == lastPage && options.ReplyMarkup != nil {
+				msg.ReplyMarkup = options.ReplyMarkup
+			}
+
+			sent, err := app.botSend(msg)
+			if err != nil {
+				log.Println("Error while sending message:", chatID, err)
+				app.stats.MessageFailed(chatID, time.Now(), err)
+				continue
+			}
+
+			app.stats.MessageSent(chatID, time.Now())
+			messageIDs = append(messageIDs, sent.MessageID)
+		}
+	}
+
+	return messageIDs
 }
 
 // Templating staff
@@ -249,6 +711,16 @@ func hasKey(dict map[string]interface{}, key_search string) bool {
 	return false
 }
 
+// formatTime formats time in configured time zone with time_outdata format
+func (app *Application) formatTime(t time.Time) string {
+	layout := app.config.TimeOutFormat
+	if layout == "" {
+		layout = "2006-01-02 15:04"
+	}
+
+	return t.In(app.location()).Format(layout)
+}
+
 // TODO: move to formaters with other template loader functions?
 func (app *Application) TemplateFuncMap() (tm template.FuncMap) {
 	tm = template.FuncMap{
@@ -260,6 +732,7 @@ func (app *Application) TemplateFuncMap() (tm template.FuncMap) {
 		"FormatByte":        app.measureConverter.FormatByte,
 		"FormatMeasureUnit": app.measureConverter.FormatMeasureUnit,
 		"HasKey":            hasKey,
+		"FormatTime":        app.formatTime,
 	}
 
 	return
@@ -275,43 +748,114 @@ func (app *Application) TextTemplateFuncMap() (tm textTemplate.FuncMap) {
 		"FormatByte":        app.measureConverter.FormatByte,
 		"FormatMeasureUnit": app.measureConverter.FormatMeasureUnit,
 		"HasKey":            hasKey,
+		"FormatTime":        app.formatTime,
 	}
 
 	return
 }
-// TODO: сейчас оно вешает весь процесс при падении здесь
-// TODO: just return an error?
-func (app *Application) RenderPrometheusAlerts(alerts *Alerts, selectedLayout appconfig.SelectedLayout) []*bytes.Buffer {
-	// extract layout templating
+// SelectLayout returns layout settings configured for chat in chats_layouts,
+// falling back to default prometheus layout
+func (app *Application) SelectLayout(chatID int64) appconfig.SelectedLayout {
+	// default render values
+	selectedLayout := appconfig.SelectedLayout{Layout: "prometheus", MessageTemplate: "prometheus", GroupByAlertName: true}
+
+	chatIDStr := strconv.FormatInt(chatID, 10)
+
+	if chatLayoutConfig, ok := app.config.ChatsLayouts[chatIDStr]; ok == true {
+		if chatLayoutConfig.Layout != "" {
+			selectedLayout.Layout = chatLayoutConfig.Layout
+		}
+
+		if chatLayoutConfig.MessageTemplate != "" {
+			selectedLayout.MessageTemplate = chatLayoutConfig.MessageTemplate
+		}
+
+		if chatLayoutConfig.GroupByAlertName != nil {
+			selectedLayout.GroupByAlertName = *chatLayoutConfig.GroupByAlertName
+		}
+
+		selectedLayout.FiringTemplate = chatLayoutConfig.FiringTemplate
+		selectedLayout.ResolvedTemplate = chatLayoutConfig.ResolvedTemplate
+		selectedLayout.FiringLayout = chatLayoutConfig.FiringLayout
+		selectedLayout.ResolvedLayout = chatLayoutConfig.ResolvedLayout
+	}
+
+	return selectedLayout
+}
+
+// parseLayout parses layout with messages wrapper template
+func (app *Application) parseLayout(name string) (*textTemplate.Template, error) {
 	layoutTemplate := textTemplate.New("TelegramMessage").Funcs(app.TextTemplateFuncMap())
-	layoutTemplate, err := layoutTemplate.Parse(app.config.Layouts[selectedLayout.Layout])
+	layoutTemplate, err := layoutTemplate.Parse(app.config.Layouts[name])
 	if err != nil {
-		log.Fatalf("Error while parsing layout %v %v", selectedLayout.Layout, err)
+		return nil, fmt.Errorf("error while parsing layout %v: %v", name, err)
 	}
 
-	layoutTemplate, err = layoutTemplate.Parse(appconfig.DefaultPrometheusMessageTemplate())
+	layoutTemplate, err = layoutTemplate.Parse(appconfig.PrometheusMessagesWrapperTemplate())
 	if err != nil {
-		log.Fatalf("Error while parsing DefaultPrometheusMessageTemplate: %v", appconfig.DefaultPrometheusMessageTemplate(), err)
+		return nil, fmt.Errorf("error while parsing PrometheusMessagesWrapperTemplate: %v", err)
+	}
+
+	return layoutTemplate, nil
+}
+
+// renderRow renders alert with firing_template or resolved_template of layout, without
+// them alert is rendered with default template. Parsed templates are cached by name
+func (app *Application) renderRow(templates map[string]*textTemplate.Template, alert Alert, selectedLayout appconfig.SelectedLayout, defaultName string, defaultText string) (*bytes.Buffer, error) {
+	name, text := defaultName, defaultText
+	if statusTemplate := selectedLayout.StatusTemplate(alert.Status); statusTemplate != "" {
+		name, text = statusTemplate, app.config.MessageTemplates[statusTemplate]
+	}
+
+	messageTemplate, ok := templates[name]
+	if !ok {
+		parsed, err := textTemplate.New("TelegramRowMessage").Funcs(app.TextTemplateFuncMap()).Parse(text)
+		if err != nil {
+			return nil, fmt.Errorf("error while parsing message template %v: %v", name, err)
+		}
+
+		templates[name] = parsed
+		messageTemplate = parsed
+	}
+
+	rendered := new(bytes.Buffer)
+	if err := messageTemplate.Execute(rendered, alert); err != nil {
+		return nil, fmt.Errorf("error while rendering message template: %v", err)
 	}
 
-	// extract message template
-	messageTemplate := textTemplate.New("TelegramRowMessage").Funcs(app.TextTemplateFuncMap())
-	messageTemplate, err = messageTemplate.Parse(app.config.MessageTemplates[selectedLayout.MessageTemplate])
+	return rendered, nil
+}
+
+// RenderAlerts renders alerts to pages ready for sending.
+// Currently there are 2 rendering types for Prometheus: with and without grouping
+func (app *Application) RenderAlerts(alerts *Alerts, selectedLayout appconfig.SelectedLayout) ([]*bytes.Buffer, error) {
+	if selectedLayout.GroupByAlertName == true {
+		return app.RenderPrometheusAlertsWithGrouping(alerts, selectedLayout)
+	}
+
+	return app.RenderPrometheusAlerts(alerts, selectedLayout)
+}
+
+func (app *Application) RenderPrometheusAlerts(alerts *Alerts, selectedLayout appconfig.SelectedLayout) ([]*bytes.Buffer, error) {
+	layoutTemplate, err := app.parseLayout(selectedLayout.LayoutFor(alerts.Status))
 	if err != nil {
-		log.Fatalf("Error while parsing message template %v %v", selectedLayout.MessageTemplate, err)
+		return nil, err
 	}
 
+	firing, resolved := alerts.Firing(), alerts.Resolved()
+
 	// render alerts (separate from template)
 	renderedMessages := make([]*bytes.Buffer, 0)
+	messageTemplates := make(map[string]*textTemplate.Template)
 
 	// TODO: debug messages render index
 
 	for _, alert := range alerts.Alerts {
-		tempBuffer := new(bytes.Buffer)
-
 		// render message row partial
-		if err := messageTemplate.Execute(tempBuffer, alert); err != nil {
-			log.Fatalf("Error while rendering message template: %v", err)
+		tempBuffer, err := app.renderRow(messageTemplates, alert, selectedLayout,
+			selectedLayout.MessageTemplate, app.config.MessageTemplates[selectedLayout.MessageTemplate])
+		if err != nil {
+			return nil, err
 		}
 
 		renderedMessages = append(renderedMessages, tempBuffer)
@@ -331,11 +875,13 @@ func (app *Application) RenderPrometheusAlerts(alerts *Alerts, selectedLayout ap
 		view.PageNumber = currentPage
 		view.PageMessages = renderedMessages[currentPageStartIndex:idx + 1]
 		view.Alerts = alerts
+		view.Firing = firing
+		view.Resolved = resolved
 
 		// render messages according page number and offset
 		temp := new(bytes.Buffer)
 		if err := layoutTemplate.Execute(temp, view); err != nil {
-			log.Fatalf("Error while rendering full template: %v", err)
+			return nil, fmt.Errorf("error while rendering full template: %v", err)
 		}
 
 		if (temp.Len()) <= app.config.SplitMessageBytes {
@@ -350,10 +896,12 @@ func (app *Application) RenderPrometheusAlerts(alerts *Alerts, selectedLayout ap
 			newPageView.PageNumber = currentPage
 			newPageView.PageMessages = renderedMessages[currentPageStartIndex:idx + 1]
 			newPageView.Alerts = alerts
+			newPageView.Firing = firing
+			newPageView.Resolved = resolved
 
 			newPageTemp := new(bytes.Buffer)
 			if err := layoutTemplate.Execute(newPageTemp, newPageView); err != nil {
-				log.Fatalf("Error while rendering full template: %v", err)
+				return nil, fmt.Errorf("error while rendering full template: %v", err)
 			}
 
 			renderedPages = append(renderedPages, new(bytes.Buffer))
@@ -368,61 +916,57 @@ func (app *Application) RenderPrometheusAlerts(alerts *Alerts, selectedLayout ap
 		}
 	}
 
-	return renderedPages
+	return renderedPages, nil
 }
 
-// TODO: сейчас оно вешает весь процесс при падении здесь
-// TODO: just return an error?
-func (app *Application) RenderPrometheusAlertsWithGrouping(alerts *Alerts, selectedLayout appconfig.SelectedLayout) []*bytes.Buffer {
-	// extract layout templating
-	layoutTemplate := textTemplate.New("TelegramMessage").Funcs(app.TextTemplateFuncMap())
-	layoutTemplate, err := layoutTemplate.Parse(app.config.Layouts[selectedLayout.Layout])
+func (app *Application) RenderPrometheusAlertsWithGrouping(alerts *Alerts, selectedLayout appconfig.SelectedLayout) ([]*bytes.Buffer, error) {
+	layoutTemplate, err := app.parseLayout(selectedLayout.LayoutFor(alerts.Status))
 	if err != nil {
-		log.Fatalf("Error while parsing layout %v %v", selectedLayout.Layout, err)
+		return nil, err
 	}
 
-	layoutTemplate, err = layoutTemplate.Parse(appconfig.PrometheusMessagesWrapperTemplate())
-	if err != nil {
-		log.Fatalf("Error while parsing DefaultPrometheusMessageTemplate: %v", appconfig.PrometheusMessagesWrapperTemplate(), err)
-	}
-
-	// extract message template
-	messageTemplate := textTemplate.New("TelegramRowMessage").Funcs(app.TextTemplateFuncMap())
-	//messageTemplate, err = messageTemplate.Parse(app.config.MessageTemplates[selectedLayout.MessageTemplate])
-	messageTemplate, err = messageTemplate.Parse(appconfig.DefaultPrometheusGroupedMessageTemplate())
-	if err != nil {
-		log.Fatalf("Error while parsing message template %v %v", selectedLayout.MessageTemplate, err)
-	}
+	// grouped alerts use built-in row template unless firing_template or resolved_template is set
+	messageTemplates := make(map[string]*textTemplate.Template)
 
-	// group rendered alerts (separate from template)
+	// group rendered alerts (separate from template), groups are kept in order of first appearance
 	groupsWithMessages := make(map[string][]*bytes.Buffer)
+	groupsOrder := make([]string, 0)
 
 	// TODO: debug messages render index
 
 	groupTemplate, err := textTemplate.New("TextTemplate").Parse(appconfig.DefaultPrometheusGroupLabelTemplate())
 	if err != nil {
-		log.Fatalf("Error while parsinng group label template: %v", err)
+		return nil, fmt.Errorf("error while parsing group label template: %v", err)
 	}
 
-	for _, alert := range alerts.Alerts {
-		renderedAlert := new(bytes.Buffer)
+	// resolved alerts of mixed group are grouped separately after firing ones
+	firing, resolved := alerts.Firing(), alerts.Resolved()
+	mixed := len(firing) > 0 && len(resolved) > 0
 
+	for _, alert := range append(firing, resolved...) {
 		// render message row partial
-		if err := messageTemplate.Execute(renderedAlert, alert); err != nil {
-			log.Fatalf("Error while rendering message template: %v", err)
+		renderedAlert, err := app.renderRow(messageTemplates, alert, selectedLayout,
+			"prometheus_grouped", appconfig.DefaultPrometheusGroupedMessageTemplate())
+		if err != nil {
+			return nil, err
 		}
 
 		// extract group key
 		if label, ok := alert.Labels["alertname"]; ok == true {
 			if labelStr, ok := label.(string); ok == true {
+				if mixed && alert.IsResolved() {
+					labelStr += " (resolved)"
+				}
+
 				// create group if not exist
 				if _, ok := groupsWithMessages[labelStr]; ok == false {
 					groupsWithMessages[labelStr] = make([]*bytes.Buffer, 0)
+					groupsOrder = append(groupsOrder, labelStr)
 
 					// first row is group label
 					renderedGroupLabel := new(bytes.Buffer)
 					if err := groupTemplate.Execute(renderedGroupLabel, labelStr); err != nil {
-						log.Fatalf("Cannot execute group label template: %v", err)
+						return nil, fmt.Errorf("cannot execute group label template: %v", err)
 					}
 
 					groupsWithMessages[labelStr] = append(groupsWithMessages[labelStr], renderedGroupLabel)
@@ -431,17 +975,17 @@ func (app *Application) RenderPrometheusAlertsWithGrouping(alerts *Alerts, selec
 				// append message to group
 				groupsWithMessages[labelStr] = append(groupsWithMessages[labelStr], renderedAlert)
 			} else {
-				log.Fatalf("Typecast failed for label %v", label)
+				return nil, fmt.Errorf("typecast failed for label %v", label)
 			}
 		} else {
-			log.Fatalf("No alertname provided inside %v", alert.Labels)
+			return nil, fmt.Errorf("no alertname provided inside %v", alert.Labels)
 		}
 	}
 
 	// map groups + messages
 	renderedMessages := make([]*bytes.Buffer, 0)
-	for _, rows := range groupsWithMessages {
-		for _, row := range rows {
+	for _, group := range groupsOrder {
+		for _, row := range groupsWithMessages[group] {
 			renderedMessages = append(renderedMessages, row)
 		}
 	}
@@ -460,11 +1004,13 @@ func (app *Application) RenderPrometheusAlertsWithGrouping(alerts *Alerts, selec
 		view.PageNumber = currentPage
 		view.PageMessages = renderedMessages[currentPageStartIndex:idx + 1]
 		view.Alerts = alerts
+		view.Firing = firing
+		view.Resolved = resolved
 
 		// render messages according page number and offset
 		temp := new(bytes.Buffer)
 		if err := layoutTemplate.Execute(temp, view); err != nil {
-			log.Fatalf("Error while rendering full template: %v", err)
+			return nil, fmt.Errorf("error while rendering full template: %v", err)
 		}
 
 		if (temp.Len()) <= app.config.SplitMessageBytes {
@@ -479,10 +1025,12 @@ func (app *Application) RenderPrometheusAlertsWithGrouping(alerts *Alerts, selec
 			newPageView.PageNumber = currentPage
 			newPageView.PageMessages = renderedMessages[currentPageStartIndex:idx + 1]
 			newPageView.Alerts = alerts
+			newPageView.Firing = firing
+			newPageView.Resolved = resolved
 
 			newPageTemp := new(bytes.Buffer)
 			if err := layoutTemplate.Execute(newPageTemp, newPageView); err != nil {
-				log.Fatalf("Error while rendering full template: %v", err)
+				return nil, fmt.Errorf("error while rendering full template: %v", err)
 			}
 
 			renderedPages = append(renderedPages, new(bytes.Buffer))
@@ -497,5 +1045,5 @@ func (app *Application) RenderPrometheusAlertsWithGrouping(alerts *Alerts, selec
 		}
 	}
 
-	return renderedPages
+	return renderedPages, nil
 }
@@ -0,0 +1,1671 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	textTemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/alertmanager"
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/cluster"
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+	"github.com/pechorin/prometheus_tbot/pkg/prometheus"
+	"github.com/pechorin/prometheus_tbot/pkg/recorder"
+	"github.com/pechorin/prometheus_tbot/pkg/runbook"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// sentMessage is a message received by fake Telegram server
+type sentMessage struct {
+	Method    string
+	ChatID    string
+	MessageID string
+	ParseMode string
+	Silent    bool
+	ReplyTo   string
+	Keyboard  string
+	Text      string
+	// size of uploaded photo
+	Photo int
+}
+
+// fakeTelegram implements subset of Telegram Bot API used by bot:
+// getMe, sendMessage, sendPhoto, editMessageText, editMessageReplyMarkup, answerCallbackQuery,
+// getChatMember, getUpdates and setWebhook
+type fakeTelegram struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	sent     []sentMessage
+	updates  []tgbotapi.Update
+	updateID int
+	// notify wakes up waitSent after message is sent. Sends do not block and may be
+	// dropped when buffer is full, so waiters must count sent messages themselves
+	notify chan struct{}
+	// chat member status by user id, users are not members by default
+	members map[int]string
+	// parameters of last setWebhook call
+	webhook url.Values
+}
+
+func newFakeTelegram(t *testing.T) *fakeTelegram {
+	fake := &fakeTelegram{notify: make(chan struct{}, 1), members: make(map[int]string)}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.server.Close)
+
+	return fake
+}
+
+func (fake *fakeTelegram) handle(w http.ResponseWriter, r *http.Request) {
+	// parses urlencoded forms too
+	r.ParseMultipartForm(10 << 20)
+
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+
+	var result interface{}
+
+	switch method {
+	case "getMe":
+		result = tgbotapi.User{ID: 1, FirstName: "tbot", UserName: "test_tbot", IsBot: true}
+	case "sendMessage", "sendPhoto", "editMessageText", "editMessageReplyMarkup":
+		photo := 0
+		if r.MultipartForm != nil && len(r.MultipartForm.File["photo"]) > 0 {
+			photo = int(r.MultipartForm.File["photo"][0].Size)
+		}
+
+		fake.mu.Lock()
+		fake.sent = append(fake.sent, sentMessage{
+			Method:    method,
+			ChatID:    r.Form.Get("chat_id"),
+			MessageID: r.Form.Get("message_id"),
+			ParseMode: r.Form.Get("parse_mode"),
+			Silent:    r.Form.Get("disable_notification") == "true",
+			ReplyTo:   r.Form.Get("reply_to_message_id"),
+			Keyboard:  r.Form.Get("reply_markup"),
+			Text:      r.Form.Get("text") + r.Form.Get("caption"),
+			Photo:     photo,
+		})
+		messageID := len(fake.sent)
+		fake.mu.Unlock()
+
+		chatID, _ := strconv.ParseInt(r.Form.Get("chat_id"), 10, 64)
+		result = tgbotapi.Message{MessageID: messageID, Chat: &tgbotapi.Chat{ID: chatID}, Text: r.Form.Get("text")}
+
+		// notify only wakes up waitSent, which counts sent messages itself
+		select {
+		case fake.notify <- struct{}{}:
+		default:
+		}
+	case "answerCallbackQuery":
+		result = true
+	case "setWebhook":
+		fake.mu.Lock()
+		fake.webhook = r.Form
+		fake.mu.Unlock()
+
+		result = true
+	case "getChatMember":
+		userID, _ := strconv.Atoi(r.Form.Get("user_id"))
+
+		fake.mu.Lock()
+		status, ok := fake.members[userID]
+		fake.mu.Unlock()
+
+		if !ok {
+			status = "left"
+		}
+
+		result = tgbotapi.ChatMember{User: &tgbotapi.User{ID: userID}, Status: status}
+	case "getUpdates":
+		fake.mu.Lock()
+		updates := fake.updates
+		fake.updates = nil
+		fake.mu.Unlock()
+
+		if len(updates) == 0 {
+			time.Sleep(10 * time.Millisecond)
+			updates = []tgbotapi.Update{}
+		}
+
+		result = updates
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"ok": false, "error_code": 404, "description": "Not Found: " + method})
+		return
+	}
+
+	raw, _ := json.Marshal(result)
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+// pushMessage queues text message from chat returned by next getUpdates call
+func (fake *fakeTelegram) pushMessage(chatID int64, text string) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	fake.updateID++
+	message := newMessage(chatID, 1000+fake.updateID, text)
+
+	fake.updates = append(fake.updates, tgbotapi.Update{UpdateID: fake.updateID, Message: message})
+}
+
+// newMessage builds text message from test user, commands get bot_command entity
+func newMessage(chatID int64, messageID int, text string) *tgbotapi.Message {
+	message := &tgbotapi.Message{
+		MessageID: messageID,
+		From:      &tgbotapi.User{ID: 42, UserName: "tester"},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "group"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = &[]tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+
+	return message
+}
+
+// waitSent waits until count messages received by server
+func (fake *fakeTelegram) waitSent(t *testing.T, count int) []sentMessage {
+	timeout := time.After(5 * time.Second)
+
+	for {
+		fake.mu.Lock()
+		sent := append([]sentMessage(nil), fake.sent...)
+		fake.mu.Unlock()
+
+		if len(sent) >= count {
+			return sent
+		}
+
+		select {
+		case <-fake.notify:
+		case <-timeout:
+			t.Fatalf("expected %d sent messages, got %d", count, len(sent))
+		}
+	}
+}
+
+func (fake *fakeTelegram) sentMessages() []sentMessage {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	return append([]sentMessage(nil), fake.sent...)
+}
+
+// rewriteTransport sends all Telegram API requests to fake server
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (rt rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.URL.Scheme = rt.target.Scheme
+	r.URL.Host = rt.target.Host
+
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newTestApplication(t *testing.T, fake *fakeTelegram) *Application {
+	config, err := appconfig.Load("testdata/config.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApplicationWithConfig(config)
+	app.bot = newTestBotAPI(t, config.TelegramToken, fake)
+
+	return app
+}
+
+func newTestBotAPI(t *testing.T, token string, fake *fakeTelegram) *tgbotapi.BotAPI {
+	target, _ := url.Parse(fake.server.URL)
+	client := &http.Client{Transport: rewriteTransport{target: target}}
+
+	bot, err := tgbotapi.NewBotAPIWithClient(token, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return bot
+}
+
+// withStore enables state for application, database is removed after test
+func withStore(t *testing.T, app *Application) *Application {
+	stateStore, err := store.Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stateStore.Close() })
+
+	app.store = stateStore
+
+	return app
+}
+
+func newTestRouter(app *Application) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/alert", app.HTTPAlertHandler)
+	router.POST("/alert/*chatids", app.HTTPAlertHandler)
+	router.POST("/api/v1/preview", app.HTTPPreviewHandler)
+	router.GET("/api/v1/history", app.HTTPHistoryHandler)
+	router.GET("/metrics", app.HTTPMetricsHandler)
+	router.GET("/-/healthy", app.HTTPHealthyHandler)
+	router.GET("/-/ready", app.HTTPReadyHandler)
+	app.routeTelegramWebhooks(router)
+
+	return router
+}
+
+func postPayload(t *testing.T, router http.Handler, path string, payloadFile string) *httptest.ResponseRecorder {
+	payload, err := ioutil.ReadFile(payloadFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(payload)))
+
+	return w
+}
+
+func formatSent(sent []sentMessage) string {
+	out := new(bytes.Buffer)
+
+	for _, msg := range sent {
+		fmt.Fprintf(out, "--- %s chat_id=%s", msg.Method, msg.ChatID)
+		if msg.MessageID != "" {
+			fmt.Fprintf(out, " message_id=%s", msg.MessageID)
+		}
+		if msg.Silent {
+			fmt.Fprint(out, " silent")
+		}
+		if msg.Keyboard != "" {
+			fmt.Fprintf(out, " keyboard=%s", msg.Keyboard)
+		}
+		fmt.Fprintf(out, " parse_mode=%s bytes=%d\n%s\n", msg.ParseMode, len(msg.Text), msg.Text)
+	}
+
+	return out.String()
+}
+
+func assertGolden(t *testing.T, name string, actual string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", "golden", name+".golden")
+
+	if *updateGolden {
+		if err := ioutil.WriteFile(path, []byte(actual), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read golden file, run tests with -update to create it: %v", err)
+	}
+
+	if string(expected) != actual {
+		t.Errorf("%s mismatch, run tests with -update if change is expected\n--- expected:\n%s\n--- actual:\n%s", path, expected, actual)
+	}
+}
+
+func TestHTTPAlertHandlerGolden(t *testing.T) {
+	cases := []struct {
+		golden  string
+		path    string
+		payload string
+	}{
+		{"simple_grouped", "/alert/1", "testdata/simple.json"},
+		{"simple_multiple_chats", "/alert/2/-3", "testdata/simple.json"},
+		{"production_grouped", "/alert/1", "testdata/production_example.json"},
+		{"production_paginated", "/alert/2", "testdata/production_example.json"},
+		{"production_mini", "/alert/-3", "testdata/production_example.json"},
+		{"production_default_layout", "/alert/100", "testdata/production_example.json"},
+		{"quiet_hours_silent", "/alert/4/6", "testdata/production_example.json"},
+		{"mixed_grouped", "/alert/1", "testdata/mixed.json"},
+		{"mixed_status_templates", "/alert/12", "testdata/mixed.json"},
+		{"mixed_status_templates_grouped", "/alert/13", "testdata/mixed.json"},
+		{"resolved_layout", "/alert/12", "testdata/simple_resolved.json"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.golden, func(t *testing.T) {
+			fake := newFakeTelegram(t)
+			app := newTestApplication(t, fake)
+
+			w := postPayload(t, newTestRouter(app), tc.path, tc.payload)
+			if w.Code != http.StatusOK {
+				t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+			}
+
+			app.deliveries.Wait()
+
+			assertGolden(t, tc.golden, formatSent(fake.sentMessages()))
+		})
+	}
+}
+
+func TestHTTPAlertHandlerBadRequests(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	router := newTestRouter(app)
+
+	if w := postPayload(t, router, "/alert/", "testdata/simple.json"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request without chats, got %d", w.Code)
+	}
+
+	if w := postPayload(t, router, "/alert/chat", "testdata/simple.json"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid chat id, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alert/1", strings.NewReader("{")))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid payload, got %d", w.Code)
+	}
+
+	app.deliveries.Wait()
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Errorf("expected no messages sent, got %d", len(sent))
+	}
+
+	// with state bare /alert routes to subscriptions, but invalid chats are still rejected
+	stateful := withStore(t, newTestApplication(t, fake))
+	router = newTestRouter(stateful)
+
+	for _, path := range []string{"/alert/chat", "/alert/unknown/1", "/alert/1/chat"} {
+		if w := postPayload(t, router, path, "testdata/simple.json"); w.Code != http.StatusBadRequest {
+			t.Errorf("expected bad request for %v with state, got %d", path, w.Code)
+		}
+	}
+
+	for _, path := range []string{"/alert", "/alert/"} {
+		if w := postPayload(t, router, path, "testdata/simple.json"); w.Code != http.StatusOK {
+			t.Errorf("expected %v to be routed to subscriptions, got %d", path, w.Code)
+		}
+	}
+	stateful.deliveries.Wait()
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Errorf("expected no messages sent without subscriptions, got %d", len(sent))
+	}
+}
+
+func TestPreviewGolden(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	router := newTestRouter(app)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/v1/preview?layout=receiver&message_template=prometheus_mini&group_by_alert_name=false&sample=production_example", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", w.Code, w.Body.String())
+	}
+
+	response := PreviewResponse{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	for _, page := range response.Pages {
+		fmt.Fprintf(out, "--- page %d bytes=%d\n%s\n", page.Number, page.Bytes, page.Text)
+	}
+
+	assertGolden(t, "preview_receiver_mini", out.String())
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Errorf("preview should not send messages, got %d", len(sent))
+	}
+}
+
+func TestTelegramBotChatIDCommand(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+
+	go app.telegramBot(app.bot)
+	defer app.bot.StopReceivingUpdates()
+
+	fake.pushMessage(-100500, "hello")
+	fake.pushMessage(-100500, "/chatid")
+
+	sent := fake.waitSent(t, 1)
+
+	assertGolden(t, "command_chatid", formatSent(sent))
+}
+
+func TestHistory(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/1/2", "testdata/production_example.json")
+	postPayload(t, router, "/alert/1", "testdata/production_example.json")
+	app.deliveries.Wait()
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/history?chat_id=1&alertname=LoadAverage_1MIN&since=7d", nil))
+
+	response := struct {
+		Notifications []store.Notification `json:"notifications"`
+		Summary       []historySummary     `json:"summary"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(w.Code, err)
+	}
+
+	// two alerts with this name, each delivered twice to chat 1
+	if len(response.Notifications) != 4 {
+		t.Errorf("expected 4 notifications, got %d", len(response.Notifications))
+	}
+
+	if len(response.Summary) != 1 || response.Summary[0].Fired != 2 {
+		t.Errorf("expected 2 firing episodes, got %+v", response.Summary)
+	}
+
+	sentBefore := len(fake.sentMessages())
+
+	go app.telegramBot(app.bot)
+	defer app.bot.StopReceivingUpdates()
+
+	fake.pushMessage(1, "/history LoadAverage_1MIN 1w")
+
+	sent := fake.waitSent(t, sentBefore+1)
+	reply := sent[len(sent)-1].Text
+
+	if !strings.Contains(reply, "<b>History for last 168h0m0s</b> <code>LoadAverage_1MIN</code>") ||
+		!strings.Contains(reply, "<code>LoadAverage_1MIN</code>: fired 2, resolved 0") {
+		t.Errorf("unexpected history reply:\n%s", reply)
+	}
+}
+
+func TestQuietHoursHold(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/5", "testdata/production_example.json")
+	postPayload(t, router, "/alert/5", "testdata/simple.json")
+	app.deliveries.Wait()
+
+	// quiet hours of chat 5 never end
+	app.flushHeldAlerts(time.Now())
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Fatalf("expected alerts to be held, got %d messages", len(sent))
+	}
+
+	held, err := app.store.TakeBuffered(store.HeldBuffer, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(held) != 2 {
+		t.Fatalf("expected 2 held payloads, got %d", len(held))
+	}
+}
+
+func TestDigest(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/7", "testdata/production_example.json")
+	postPayload(t, router, "/alert/7", "testdata/simple.json")
+	postPayload(t, router, "/alert/7", "testdata/production_example.json")
+	app.deliveries.Wait()
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Fatalf("expected alerts to be buffered for digest, got %d messages", len(sent))
+	}
+
+	// digest interval is not over yet
+	app.flushDigests(time.Now())
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Fatalf("expected digest to wait for interval, got %d messages", len(sent))
+	}
+
+	buffered, err := app.store.TakeBuffered(store.DigestBuffer, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	view := app.buildDigest(buffered, time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC))
+	view.Since = time.Date(2026, 10, 19, 11, 0, 0, 0, time.UTC)
+
+	pages, err := app.RenderDigest(view, "digest")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	for idx, page := range pages {
+		fmt.Fprintf(out, "--- page %d bytes=%d\n%s\n", idx, page.Len(), page.String())
+	}
+
+	assertGolden(t, "digest", out.String())
+
+	for _, payload := range []string{"testdata/simple.json", "testdata/production_example.json"} {
+		postPayload(t, router, "/alert/7", payload)
+	}
+	app.deliveries.Wait()
+
+	app.flushDigests(time.Now().Add(2 * time.Hour))
+
+	// digest is split to 2 pages by split_msg_byte
+	if sent := fake.sentMessages(); len(sent) != 2 || !strings.Contains(sent[0].Text, "2 notifications, 12 firing, 0 resolved") {
+		t.Errorf("expected digest message to be sent, got %+v", sent)
+	}
+}
+
+func TestEscalation(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	// chat 1 is not watched by escalation policy
+	postPayload(t, router, "/alert/8/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	fake.waitSent(t, 2)
+
+	started := time.Now()
+
+	app.escalate(started.Add(10 * time.Minute))
+	if sent := fake.sentMessages(); len(sent) != 2 {
+		t.Fatalf("expected no escalation before 15m, got %d messages", len(sent))
+	}
+
+	app.escalate(started.Add(16 * time.Minute))
+	if sent := fake.waitSent(t, 3); sent[2].ChatID != "9" {
+		t.Fatalf("expected alert escalated to chat 9, got %v", sent[2].ChatID)
+	}
+
+	// fake server numbers messages in order they were sent
+	escalatedMessageID := 3
+
+	app.callbackQuery(&tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: 42, UserName: "tester"},
+		Message: &tgbotapi.Message{MessageID: escalatedMessageID, Chat: &tgbotapi.Chat{ID: 9}},
+		Data:    ackCallbackData,
+	})
+	fake.waitSent(t, 4)
+
+	// acknowledged alerts are not escalated to next level
+	app.escalate(started.Add(31 * time.Minute))
+	if sent := fake.sentMessages(); len(sent) != 4 {
+		t.Fatalf("expected acknowledged alert not to escalate, got %d messages", len(sent))
+	}
+
+	postPayload(t, router, "/alert/8", "testdata/simple_resolved.json")
+	app.deliveries.Wait()
+
+	escalations, err := app.store.Escalations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(escalations) != 0 {
+		t.Fatalf("expected resolved alert escalation to be closed, got %d", len(escalations))
+	}
+
+	assertGolden(t, "escalation", formatSent(fake.waitSent(t, 6)))
+}
+
+func TestAck(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	fake.waitSent(t, 1)
+
+	ack := newMessage(1, 100, "/ack")
+	ack.ReplyToMessage = &tgbotapi.Message{MessageID: 1, Chat: ack.Chat}
+	app.dispatchCommand(ack)
+	fake.waitSent(t, 3)
+
+	// repeated notification of acknowledged alert shows ack
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	fake.waitSent(t, 4)
+
+	app.dispatchCommand(newMessage(1, 101, "/alerts"))
+	fake.waitSent(t, 5)
+
+	unack := newMessage(1, 102, "/unack")
+	unack.ReplyToMessage = &tgbotapi.Message{MessageID: 4, Chat: unack.Chat}
+	app.dispatchCommand(unack)
+
+	assertGolden(t, "ack", formatSent(fake.waitSent(t, 7)))
+}
+
+// fakeAlertmanager implements silences subset of Alertmanager API v2
+type fakeAlertmanager struct {
+	mu       sync.Mutex
+	silences []alertmanager.Silence
+	expired  []string
+}
+
+func newFakeAlertmanager(t *testing.T) (*fakeAlertmanager, *httptest.Server) {
+	fake := &fakeAlertmanager{}
+	server := httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(server.Close)
+
+	return fake, server
+}
+
+func (fake *fakeAlertmanager) handle(w http.ResponseWriter, r *http.Request) {
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/v2/silences":
+		silence := alertmanager.Silence{}
+		json.NewDecoder(r.Body).Decode(&silence)
+
+		silence.ID = fmt.Sprintf("%08d-0000-0000-0000-000000000000", len(fake.silences)+1)
+		silence.Status = &alertmanager.SilenceStatus{State: "active"}
+		fake.silences = append(fake.silences, silence)
+
+		json.NewEncoder(w).Encode(map[string]string{"silenceID": silence.ID})
+	case r.Method == http.MethodGet && r.URL.Path == "/api/v2/silences":
+		json.NewEncoder(w).Encode(fake.silences)
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+		id := strings.TrimPrefix(r.URL.Path, "/api/v2/silence/")
+		fake.expired = append(fake.expired, id)
+
+		for idx := range fake.silences {
+			if fake.silences[idx].ID == id {
+				fake.silences[idx].Status.State = "expired"
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestSilences(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+
+	fakeAM, server := newFakeAlertmanager(t)
+	app.alertmanager = alertmanager.New(server.URL)
+	app.config.AdminUserIDs = []int{42}
+
+	app.dispatchCommand(newMessage(1, 100, "/silence alertname=Disk instance=~db.* 2h db migration"))
+	fake.waitSent(t, 1)
+
+	if len(fakeAM.silences) != 1 {
+		t.Fatalf("expected silence to be created, got %d", len(fakeAM.silences))
+	}
+
+	created := fakeAM.silences[0]
+	if matchers := fmt.Sprint(created.Matchers); matchers != `[alertname="Disk" instance=~"db.*"]` {
+		t.Errorf("unexpected silence matchers %v", matchers)
+	}
+
+	if created.Comment != "db migration" || created.CreatedBy != "@tester" {
+		t.Errorf("unexpected silence comment %q by %q", created.Comment, created.CreatedBy)
+	}
+
+	if duration := created.EndsAt.Sub(created.StartsAt); duration != 2*time.Hour {
+		t.Errorf("expected 2h silence, got %v", duration)
+	}
+
+	// fixed time for golden output
+	fakeAM.silences[0].EndsAt = time.Date(2026, 10, 19, 14, 0, 0, 0, time.UTC)
+
+	app.dispatchCommand(newMessage(1, 101, "/silences"))
+	fake.waitSent(t, 2)
+
+	outsider := newMessage(1, 102, "/unsilence 00000001")
+	outsider.From = &tgbotapi.User{ID: 7, UserName: "outsider"}
+	app.dispatchCommand(outsider)
+	fake.waitSent(t, 3)
+
+	if len(fakeAM.expired) != 0 {
+		t.Fatalf("expected silence not to be expired by outsider")
+	}
+
+	app.callbackQuery(&tgbotapi.CallbackQuery{
+		ID:      "1",
+		From:    &tgbotapi.User{ID: 42, UserName: "tester"},
+		Message: &tgbotapi.Message{MessageID: 2, Chat: &tgbotapi.Chat{ID: 1}},
+		Data:    expireCallbackPrefix + created.ID,
+	})
+
+	if len(fakeAM.expired) != 1 || fakeAM.expired[0] != created.ID {
+		t.Fatalf("expected silence %v to be expired, got %v", created.ID, fakeAM.expired)
+	}
+
+	sent := fake.waitSent(t, 4)
+	assertGolden(t, "silences", formatSent(sent[1:]))
+}
+
+func TestCommandRouter(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+
+	app.config.AdminUserIDs = []int{1}
+	app.config.MemberChatIDs = []int64{-100}
+	app.config.CommandPermissions = map[string]appconfig.Role{"history": appconfig.RoleChatAdmin}
+
+	fake.members[42] = "member"
+	fake.members[43] = "administrator"
+
+	fromUser := func(message *tgbotapi.Message, userID int) *tgbotapi.Message {
+		message.From = &tgbotapi.User{ID: userID, UserName: fmt.Sprintf("user%d", userID)}
+		return message
+	}
+
+	app.dispatchCommand(newMessage(1, 100, "/help"))
+	// command for another bot in group chat is ignored
+	app.dispatchCommand(newMessage(1, 101, "/alerts@other_bot"))
+	app.dispatchCommand(newMessage(1, 102, "/alerts@test_tbot"))
+	// not a member of chat -100
+	app.dispatchCommand(fromUser(newMessage(1, 103, "/ack"), 7))
+	app.dispatchCommand(fromUser(newMessage(1, 104, "/ack"), 42))
+	// history requires chat admin
+	app.dispatchCommand(fromUser(newMessage(1, 105, "/history"), 42))
+	app.dispatchCommand(fromUser(newMessage(1, 106, "/history"), 43))
+	app.dispatchCommand(fromUser(newMessage(1, 107, "/unsilence"), 1))
+
+	assertGolden(t, "commands", formatSent(fake.waitSent(t, 7)))
+}
+
+func TestSubscriptions(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	fake.members[42] = "administrator"
+
+	app.dispatchCommand(newMessage(11, 100, "/subscribe severity=warning env=~prod|staging"))
+	app.dispatchCommand(newMessage(12, 101, "/subscribe severity=critical"))
+	app.dispatchCommand(newMessage(11, 102, "/subscriptions"))
+	fake.waitSent(t, 3)
+
+	// only chat 11 is subscribed to warnings
+	if w := postPayload(t, router, "/alert", "testdata/simple.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected generic /alert to be accepted, got %d", w.Code)
+	}
+	app.deliveries.Wait()
+	fake.waitSent(t, 4)
+
+	// chat from URL is not duplicated by subscription
+	postPayload(t, router, "/alert/1/11", "testdata/simple.json")
+	app.deliveries.Wait()
+	fake.waitSent(t, 6)
+
+	// subscription of another chat cannot be removed
+	app.dispatchCommand(newMessage(12, 103, "/unsubscribe 1"))
+	app.dispatchCommand(newMessage(11, 104, "/unsubscribe 1"))
+	fake.waitSent(t, 8)
+
+	postPayload(t, router, "/alert", "testdata/simple.json")
+	app.deliveries.Wait()
+
+	sent := fake.sentMessages()
+	if len(sent) != 8 {
+		t.Fatalf("expected no deliveries after unsubscribe, got %d messages", len(sent))
+	}
+
+	for idx, chatID := range []string{"11", "12", "11", "11", "1", "11", "12", "11"} {
+		if sent[idx].ChatID != chatID {
+			t.Errorf("message %d: expected chat %v, got %v", idx, chatID, sent[idx].ChatID)
+		}
+	}
+
+	assertGolden(t, "subscriptions", formatSent(append(append(sent[:3:3], sent[6]), sent[7])))
+}
+
+func TestMute(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	app.dispatchCommand(newMessage(1, 100, "/mute 2h severity=warning"))
+	fake.waitSent(t, 1)
+
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+
+	// mute of chat 1 does not affect other chats
+	postPayload(t, router, "/alert/2", "testdata/simple.json")
+	app.deliveries.Wait()
+
+	if sent := fake.waitSent(t, 2); len(sent) != 2 || sent[1].ChatID != "2" {
+		t.Fatalf("expected muted alerts not to be sent to chat 1, got %d messages", len(sent))
+	}
+
+	// mute is not over yet
+	app.flushMutes(time.Now())
+
+	app.dispatchCommand(newMessage(1, 101, "/unmute"))
+	sent := fake.waitSent(t, 4)
+
+	if !strings.Contains(sent[2].Text, "Chat unmuted by @tester") {
+		t.Errorf("expected unmute reply, got %q", sent[2].Text)
+	}
+
+	if !strings.Contains(sent[3].Text, "Received while muted") || !strings.Contains(sent[3].Text, "2 notifications, 1 firing") {
+		t.Errorf("expected summary of muted alerts, got %q", sent[3].Text)
+	}
+
+	// alerts are delivered again after unmute
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	fake.waitSent(t, 5)
+}
+
+func TestStatus(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	fake.waitSent(t, 1)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/alert", strings.NewReader("{")))
+
+	// status shows chat ids and errors, only admins see it by default
+	app.dispatchCommand(newMessage(1, 99, "/status"))
+	if sent := fake.waitSent(t, 2); strings.Contains(sent[1].Text, "Version") {
+		t.Fatalf("expected status to be denied for non admin, got %q", sent[1].Text)
+	}
+
+	if loadedAt := app.stats.Snapshot().ConfigLoadedAt; !loadedAt.Equal(app.config.LoadedAt) || loadedAt.IsZero() {
+		t.Errorf("expected config load time in stats, got %v", loadedAt)
+	}
+
+	app.config.AdminUserIDs = []int{42}
+	app.dispatchCommand(newMessage(1, 100, "/status"))
+	sent := fake.waitSent(t, 3)
+	sent = append(sent[:1], sent[2:]...)
+
+	for _, expected := range []string{
+		"Version: <code>dev</code>",
+		"Webhooks: 1 accepted, 1 rejected",
+		"Queue: 0 pending deliveries",
+		"<code>admins</code>: 1 webhooks",
+		"<code>1</code>: 1 sent, 0 failed",
+	} {
+		if !strings.Contains(sent[1].Text, expected) {
+			t.Errorf("expected %q in status, got %q", expected, sent[1].Text)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	for _, expected := range []string{
+		`tbot_build_info{version="dev"} 1`,
+		`tbot_webhooks_total{receiver="admins"} 1`,
+		`tbot_webhooks_rejected_total 1`,
+		`tbot_messages_sent_total{chat_id="1"} 1`,
+	} {
+		if !strings.Contains(w.Body.String(), expected) {
+			t.Errorf("expected %q in metrics, got %q", expected, w.Body.String())
+		}
+	}
+}
+
+func TestWatchdog(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	router := newTestRouter(app)
+
+	// heartbeats are accepted without chats and are not delivered
+	if w := postPayload(t, router, "/alert", "testdata/watchdog.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected heartbeat to be accepted, got %d: %v", w.Code, w.Body.String())
+	}
+	app.deliveries.Wait()
+
+	now := time.Now()
+
+	app.checkWatchdogs(now.Add(4 * time.Minute))
+	app.checkWatchdogs(now.Add(6 * time.Minute))
+	// outage is reported once
+	app.checkWatchdogs(now.Add(7 * time.Minute))
+
+	sent := fake.waitSent(t, 1)
+	if sent[0].ChatID != "11" || !strings.Contains(sent[0].Text, "Alerting pipeline is down") || !strings.Contains(sent[0].Text, "receiver <code>heartbeat</code>") {
+		t.Errorf("expected pipeline down message in chat 11, got %v %q", sent[0].ChatID, sent[0].Text)
+	}
+
+	postPayload(t, router, "/alert", "testdata/watchdog.json")
+	app.deliveries.Wait()
+
+	sent = fake.waitSent(t, 2)
+	if sent[1].ChatID != "11" || !strings.Contains(sent[1].Text, "Alerting pipeline recovered") {
+		t.Errorf("expected recovered message in chat 11, got %v %q", sent[1].ChatID, sent[1].Text)
+	}
+
+	app.checkWatchdogs(time.Now().Add(time.Minute))
+
+	if sent := fake.sentMessages(); len(sent) != 2 {
+		t.Errorf("expected no messages while heartbeats arrive, got %d", len(sent))
+	}
+}
+
+func TestDedup(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	app.config.DedupWindow.Duration = 10 * time.Minute
+	app.config.DedupAction = appconfig.DedupActionReply
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+
+	sent := fake.waitSent(t, 3)
+
+	for idx, expected := range []string{"2nd", "3rd"} {
+		reply := sent[idx+1]
+		if reply.ReplyTo != "1" || !reply.Silent || reply.Text != "🔁 Still firing ("+expected+" time)" {
+			t.Errorf("expected silent still firing reply to first message, got %+v", reply)
+		}
+	}
+
+	// other chats and resolved notification are not duplicates
+	postPayload(t, router, "/alert/2", "testdata/simple.json")
+	app.deliveries.Wait()
+	postPayload(t, router, "/alert/1", "testdata/simple_resolved.json")
+	app.deliveries.Wait()
+	postPayload(t, router, "/alert/1", "testdata/simple_resolved.json")
+	app.deliveries.Wait()
+
+	if sent := fake.waitSent(t, 5); len(sent) != 5 {
+		t.Errorf("expected resolved duplicate to be dropped, got %d messages", len(sent))
+	}
+
+	// notification is delivered again after window
+	for _, entry := range app.delivered {
+		entry.deliveredAt = entry.deliveredAt.Add(-time.Hour)
+	}
+	postPayload(t, router, "/alert/1", "testdata/simple.json")
+	app.deliveries.Wait()
+
+	if sent := fake.waitSent(t, 6); !strings.Contains(sent[5].Text, "something_happend") {
+		t.Errorf("expected notification after dedup window, got %q", sent[5].Text)
+	}
+}
+
+func TestAlertStatus(t *testing.T) {
+	payload, err := ioutil.ReadFile("testdata/mixed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts := new(Alerts)
+	if err := json.Unmarshal(payload, alerts); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(alerts.Firing()) != 2 || len(alerts.Resolved()) != 1 {
+		t.Fatalf("expected 2 firing and 1 resolved alerts, got %d and %d", len(alerts.Firing()), len(alerts.Resolved()))
+	}
+
+	resolved := alerts.Resolved()[0]
+	if resolved.Fingerprint != "a1b2c3d4e5f60718" || resolved.Duration() != 30*time.Minute {
+		t.Errorf("unexpected resolved alert %v, duration %v", resolved.Fingerprint, resolved.Duration())
+	}
+
+	// state uses Alertmanager fingerprint, labels hash only when it is missing
+	if resolved.ID() != resolved.Fingerprint {
+		t.Errorf("expected Alertmanager fingerprint as alert id, got %v", resolved.ID())
+	}
+
+	withoutFingerprint := resolved
+	withoutFingerprint.Fingerprint = ""
+	if withoutFingerprint.ID() != resolved.LabelsFingerprint() {
+		t.Errorf("expected labels fingerprint as alert id, got %v", withoutFingerprint.ID())
+	}
+
+	// templates get times as sent by Alertmanager
+	tmpl := textTemplate.Must(textTemplate.New("times").Parse(`{{ .StartsAt }} {{ if eq .EndsAt "0001-01-01T00:00:00Z" }}firing{{ else }}ended{{ end }} {{ .StartsAtTime.Unix }}`))
+	out := new(bytes.Buffer)
+	if err := tmpl.Execute(out, resolved); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := resolved.StartsAt + " ended " + fmt.Sprint(resolved.StartsAtTime().Unix()); out.String() != expected || resolved.StartsAtTime().IsZero() {
+		t.Errorf("unexpected alert times in template %q", out.String())
+	}
+
+	// alerts without status get status of group
+	payload, err = ioutil.ReadFile("testdata/simple_resolved.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var legacy map[string]interface{}
+	json.Unmarshal(payload, &legacy)
+	for _, alert := range legacy["alerts"].([]interface{}) {
+		delete(alert.(map[string]interface{}), "status")
+	}
+	payload, _ = json.Marshal(legacy)
+
+	alerts = new(Alerts)
+	if err := json.Unmarshal(payload, alerts); err != nil {
+		t.Fatal(err)
+	}
+
+	if !alerts.Alerts[0].IsResolved() {
+		t.Errorf("expected alert to get resolved status of group")
+	}
+}
+
+func TestGraphs(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+
+	queries := make(chan string, 10)
+	prometheusServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries <- r.URL.Query().Get("query")
+
+		if r.URL.Query().Get("query") == "down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[
+			{"metric":{"instance":"a"},"values":[[1461789000,"1"],[1461789060,"3"],[1461789120,"2"]]},
+			{"metric":{"instance":"b"},"values":[[1461789000,"0.5"],[1461789120,"NaN"]]}]}}`)
+	}))
+	defer prometheusServer.Close()
+
+	app.config.Graph = &appconfig.Graph{MaxGraphs: 2, Width: 400, Height: 200}
+	app.config.Graph.Range.Duration = time.Hour
+	app.prometheus = prometheus.New(prometheusServer.URL)
+
+	alerts := &Alerts{Status: "firing", Receiver: "admins", Alerts: []Alert{
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "Load"}, GeneratorURL: "http://prometheus:9090/graph?g0.expr=node_load1+%3E+2&g0.tab=1"},
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "Load2"}, GeneratorURL: "http://prometheus:9090/graph?g0.expr=node_load1+%3E+2&g0.tab=1"},
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "Down"}, GeneratorURL: "http://prometheus:9090/graph?g0.expr=down"},
+		{Status: "resolved", Labels: map[string]interface{}{"alertname": "Old"}, GeneratorURL: "http://prometheus:9090/graph?g0.expr=old"},
+	}}
+
+	app.send(alerts, 1, SendOptions{})
+	sent := fake.waitSent(t, 2)
+
+	if query := <-queries; query != "node_load1 > 2" {
+		t.Errorf("unexpected graph query %q", query)
+	}
+
+	if query := <-queries; query != "down" {
+		t.Errorf("unexpected graph query %q", query)
+	}
+
+	photo := sent[1]
+	if photo.Method != "sendPhoto" || photo.Photo == 0 || photo.ReplyTo != "1" || !photo.Silent {
+		t.Errorf("expected silent graph reply to alert message, got %+v", photo)
+	}
+
+	if !strings.Contains(photo.Text, "<code>node_load1 &gt; 2</code>") || !strings.Contains(photo.Text, "min 0.5, max 3") {
+		t.Errorf("unexpected graph caption %q", photo.Text)
+	}
+
+	// unreachable Prometheus leaves alert without graph
+	if sent := fake.sentMessages(); len(sent) != 2 {
+		t.Errorf("expected only one graph, got %d messages", len(sent))
+	}
+
+	// the same notification to other chat reuses rendered graphs and failures
+	app.send(alerts, 2, SendOptions{})
+	if sent := fake.waitSent(t, 4); sent[3].Method != "sendPhoto" || sent[3].ChatID != "2" {
+		t.Errorf("expected graph reply in second chat, got %+v", sent[3])
+	}
+
+	if len(queries) != 0 {
+		t.Errorf("expected graphs to be rendered once, got %d more queries", len(queries))
+	}
+
+	// escaped expression is cut on characters and keeps caption within Telegram limit
+	expr := strings.Repeat("a<ж", 400)
+	app.graphs[expr] = renderedGraph{png: []byte("png"), renderedAt: time.Now()}
+	app.sendGraphs(&Alerts{Alerts: []Alert{
+		{Status: "firing", GeneratorURL: "http://prometheus:9090/graph?g0.expr=" + url.QueryEscape(expr)},
+	}}, 3, 1, time.Now())
+
+	caption := fake.waitSent(t, 5)[4].Text
+	if !utf8.ValidString(caption) || utf8.RuneCountInString(caption) > 1024 || !strings.Contains(caption, "…</code>") {
+		t.Errorf("unexpected long graph caption %d %q", utf8.RuneCountInString(caption), caption)
+	}
+}
+
+func TestRunbooks(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "high-load.md"), []byte("# High load\n\n## First steps\n\nCheck <top> output\n\n## Escalation\n\nCall ops\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	app.config.Runbooks = &appconfig.Runbooks{Sources: []runbook.Source{{Prefix: "https://wiki.example.com/", Path: dir}}, Section: "First steps", MaxLength: 1000}
+	app.runbooks = runbook.New(app.config.Runbooks.Sources, time.Minute)
+
+	alerts := &Alerts{Status: "firing", Receiver: "admins", Alerts: []Alert{
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "Load"}, Annotations: map[string]interface{}{"runbook_url": "https://wiki.example.com/high-load"}},
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "Unknown"}, Annotations: map[string]interface{}{"runbook_url": "https://other.example.com/unknown"}},
+	}}
+
+	app.send(alerts, 1, SendOptions{})
+	sent := fake.waitSent(t, 2)
+
+	expected := "📖 <a href=\"https://wiki.example.com/high-load\">Load</a>\n<blockquote expandable>Check &lt;top&gt; output</blockquote>"
+	if sent[1].Text != expected || sent[1].ReplyTo != "1" || !sent[1].Silent {
+		t.Errorf("unexpected runbook reply %+v", sent[1])
+	}
+
+	// long sections are sent in separate replies cut to Telegram limit after escaping
+	long := "# Disk\n\n## First steps\n\n" + strings.Repeat("<&>", 1200) + "\n"
+	for _, name := range []string{"disk-a.md", "disk-b.md"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(long), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app.config.Runbooks.MaxLength = 3500
+	app.send(&Alerts{Status: "firing", Receiver: "admins", Alerts: []Alert{
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "DiskA"}, Annotations: map[string]interface{}{"runbook_url": "https://wiki.example.com/disk-a"}},
+		{Status: "firing", Labels: map[string]interface{}{"alertname": "DiskB"}, Annotations: map[string]interface{}{"runbook_url": "https://wiki.example.com/disk-b"}},
+	}}, 1, SendOptions{})
+	sent = fake.waitSent(t, 5)
+
+	for _, reply := range sent[3:] {
+		if length := utf8.RuneCountInString(reply.Text); length > telegramMessageLimit || !strings.HasSuffix(reply.Text, "&gt;…</blockquote>") {
+			t.Errorf("expected runbook reply cut to Telegram limit, got %d characters %q", length, reply.Text[len(reply.Text)-40:])
+		}
+	}
+}
+
+func TestBots(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	router := newTestRouter(app)
+
+	partnerFake := newFakeTelegram(t)
+	partner := app.bots["partner"]
+	partner.bot = newTestBotAPI(t, partner.config.TelegramToken, partnerFake)
+
+	if w := postPayload(t, router, "/alert/partner/21", "testdata/simple.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected webhook for bot to be accepted, got %d: %v", w.Code, w.Body.String())
+	}
+	partner.deliveries.Wait()
+
+	sent := partnerFake.waitSent(t, 1)
+	if sent[0].ChatID != "21" || !strings.HasPrefix(sent[0].Text, "<b>Partner</b>") {
+		t.Errorf("expected message from partner bot with its layout, got %v %q", sent[0].ChatID, sent[0].Text)
+	}
+
+	if w := postPayload(t, router, "/alert/1", "testdata/simple.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected webhook for main bot to be accepted, got %d", w.Code)
+	}
+	app.deliveries.Wait()
+
+	fake.waitSent(t, 1)
+	if sent := partnerFake.sentMessages(); len(sent) != 1 {
+		t.Errorf("expected main bot webhook not to reach partner bot, got %d messages", len(sent))
+	}
+
+	if partner.stats != app.stats || partner.limiter == app.limiter {
+		t.Errorf("expected bots to share stats and have own rate limiters")
+	}
+
+	if w := postPayload(t, router, "/alert/partner", "testdata/simple.json"); w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for bot without chats, got %d", w.Code)
+	}
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter := newRateLimiter(2)
+	now := time.Now()
+
+	waits := []time.Duration{}
+	for idx := 0; idx < 4; idx++ {
+		waits = append(waits, limiter.reserve(now))
+	}
+
+	expected := []time.Duration{0, 0, 500 * time.Millisecond, time.Second}
+	if fmt.Sprint(waits) != fmt.Sprint(expected) {
+		t.Errorf("expected waits %v, got %v", expected, waits)
+	}
+
+	// bucket refills after a second
+	if wait := limiter.reserve(now.Add(3 * time.Second)); wait != 0 {
+		t.Errorf("expected no wait after refill, got %v", wait)
+	}
+}
+
+func TestTelegramWebhook(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	app.config.TelegramWebhook = &appconfig.TelegramWebhook{URL: "https://tbot.example.com/", Path: "/telegram", SecretToken: "s3cret"}
+
+	if err := app.setTelegramWebhook(); err != nil {
+		t.Fatal(err)
+	}
+
+	if endpoint := fake.webhook.Get("url"); endpoint != "https://tbot.example.com/telegram" || fake.webhook.Get("secret_token") != "s3cret" {
+		t.Errorf("unexpected webhook registration %v", fake.webhook)
+	}
+
+	router := newTestRouter(app)
+
+	update, _ := json.Marshal(tgbotapi.Update{UpdateID: 1, Message: newMessage(5, 100, "/chatid")})
+	post := func(secret string) int {
+		r := httptest.NewRequest(http.MethodPost, "/telegram", bytes.NewReader(update))
+		if secret != "" {
+			r.Header.Set("X-Telegram-Bot-Api-Secret-Token", secret)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		return w.Code
+	}
+
+	if code := post(""); code != http.StatusUnauthorized {
+		t.Errorf("expected update without secret token to be rejected, got %d", code)
+	}
+
+	if code := post("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected update with wrong secret token to be rejected, got %d", code)
+	}
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Fatalf("expected rejected updates not to be handled, got %d messages", len(sent))
+	}
+
+	if code := post("s3cret"); code != http.StatusOK {
+		t.Fatalf("expected update to be accepted, got %d", code)
+	}
+
+	sent := fake.sentMessages()
+	if len(sent) != 1 || sent[0].ChatID != "5" || !strings.Contains(sent[0].Text, "5") {
+		t.Errorf("expected reply to command from webhook, got %+v", sent)
+	}
+}
+
+func TestCluster(t *testing.T) {
+	claims, err := cluster.NewFileClaims(t.TempDir(), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake := newFakeTelegram(t)
+	leader := newTestApplication(t, fake)
+	leader.joinCluster(claims, nil)
+	atomic.StoreInt32(&leader.standby, 0)
+
+	replica := newTestApplication(t, fake)
+	replica.joinCluster(claims, nil)
+
+	// replica without state and watchdogs delivers webhooks while it is standby
+	watchdogs := replica.config.Watchdogs
+	replica.config.Watchdogs = nil
+
+	for _, app := range []*Application{leader, replica} {
+		if w := postPayload(t, newTestRouter(app), "/alert/1", "testdata/simple.json"); w.Code != http.StatusOK {
+			t.Fatalf("expected webhook to be accepted, got %d", w.Code)
+		}
+		app.deliveries.Wait()
+	}
+
+	if sent := fake.sentMessages(); len(sent) != 1 {
+		t.Errorf("expected notification accepted by both replicas to be sent once, got %d", len(sent))
+	}
+
+	postPayload(t, newTestRouter(replica), "/alert/2", "testdata/simple.json")
+	replica.deliveries.Wait()
+
+	if sent := fake.sentMessages(); len(sent) != 2 {
+		t.Errorf("expected notification for other chats to be sent, got %d", len(sent))
+	}
+
+	replica.config.StatePath = "state.db"
+	if w := postPayload(t, newTestRouter(replica), "/alert/3", "testdata/simple.json"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected standby replica with state to reject webhook, got %d", w.Code)
+	}
+
+	w := httptest.NewRecorder()
+	newTestRouter(replica).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/history", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected standby replica with state not to serve history, got %d", w.Code)
+	}
+
+	// with spool standby replica passes webhooks to leader
+	spool, err := cluster.NewSpool(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	replica.joinCluster(claims, spool)
+
+	if w := postPayload(t, newTestRouter(replica), "/alert/3", "testdata/simple.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected standby replica with spool to accept webhook, got %d", w.Code)
+	}
+
+	withStore(t, leader)
+	if err := spool.Take(leader.acceptSpooled); err != nil {
+		t.Fatal(err)
+	}
+	leader.deliveries.Wait()
+
+	sent := fake.waitSent(t, 3)
+	if sent[2].ChatID != "3" {
+		t.Errorf("expected spooled webhook to be delivered by leader, got chat %v", sent[2].ChatID)
+	}
+
+	// the same notification sent by other Alertmanager peer to leader is skipped
+	postPayload(t, newTestRouter(leader), "/alert/3", "testdata/simple.json")
+	leader.deliveries.Wait()
+
+	if sent := fake.sentMessages(); len(sent) != 3 {
+		t.Errorf("expected spooled notification to be claimed, got %d messages", len(sent))
+	}
+
+	// heartbeat accepted by standby replica reaches watchdog of leader
+	replica.config.StatePath = ""
+	replica.config.Watchdogs = watchdogs
+	leader.watchdogs["heartbeat"] = &watchdogState{lastSeenAt: time.Now().Add(-time.Hour), down: true}
+
+	if w := postPayload(t, newTestRouter(replica), "/alert", "testdata/watchdog.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected standby replica to spool heartbeat, got %d", w.Code)
+	}
+
+	if state := replica.watchdogs["heartbeat"]; state != nil {
+		t.Errorf("expected heartbeat not to be recorded by standby replica, got %+v", state)
+	}
+
+	if err := spool.Take(leader.acceptSpooled); err != nil {
+		t.Fatal(err)
+	}
+
+	if sent := fake.waitSent(t, 4); !strings.Contains(sent[3].Text, "Alerting pipeline recovered") {
+		t.Errorf("expected leader to get heartbeat from standby replica, got %q", sent[3].Text)
+	}
+}
+
+func TestShutdownOutbox(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	// shutdown timeout is over before alerts are delivered
+	app.abortDeliveries()
+
+	if w := postPayload(t, router, "/alert/1", "testdata/simple.json"); w.Code != http.StatusOK {
+		t.Fatalf("expected webhook to be accepted, got %d", w.Code)
+	}
+	app.deliveries.Wait()
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Fatalf("expected no messages after shutdown, got %d", len(sent))
+	}
+
+	chats, err := app.store.BufferedChats(store.OutboxBuffer)
+	if err != nil || len(chats) != 1 || chats[0].ChatID != 1 {
+		t.Fatalf("expected undelivered alerts in outbox, got %v %v", chats, err)
+	}
+
+	// bot started again
+	app.deliveryCtx, app.abortDeliveries = context.WithCancel(context.Background())
+	app.flushOutbox()
+
+	sent := fake.waitSent(t, 1)
+	if sent[0].ChatID != "1" || !strings.Contains(sent[0].Text, "Firing") {
+		t.Errorf("expected outbox alerts to be delivered, got %v %q", sent[0].ChatID, sent[0].Text)
+	}
+
+	if chats, _ := app.store.BufferedChats(store.OutboxBuffer); len(chats) != 0 {
+		t.Errorf("expected outbox to be empty, got %v", chats)
+	}
+}
+
+func TestShutdownDigest(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := withStore(t, newTestApplication(t, fake))
+	router := newTestRouter(app)
+
+	postPayload(t, router, "/alert/7", "testdata/simple.json")
+	postPayload(t, router, "/alert/7", "testdata/production_example.json")
+	app.deliveries.Wait()
+
+	// shutdown timeout is over while digest is flushed
+	app.stop()
+	app.abortDeliveries()
+	app.flushDigests(time.Now().Add(2 * time.Hour))
+
+	if sent := fake.sentMessages(); len(sent) != 0 {
+		t.Fatalf("expected no digest after shutdown, got %d messages", len(sent))
+	}
+
+	if chats, _ := app.store.BufferedChats(store.OutboxBuffer); len(chats) != 0 {
+		t.Errorf("expected digest alerts not to be moved to outbox, got %v", chats)
+	}
+
+	chats, err := app.store.BufferedChats(store.DigestBuffer)
+	if err != nil || len(chats) != 1 || chats[0].ChatID != 7 {
+		t.Fatalf("expected digest alerts to be kept for digest, got %v %v", chats, err)
+	}
+
+	// after restart digest is sent once, not as separate messages
+	app.deliveryCtx, app.abortDeliveries = context.WithCancel(context.Background())
+	app.flushDigests(time.Now().Add(2 * time.Hour))
+
+	if sent := fake.sentMessages(); len(sent) == 0 || !strings.Contains(sent[0].Text, "2 notifications") {
+		t.Errorf("expected kept alerts to be sent as digest, got %+v", sent)
+	}
+
+	// stopped loops return and state is closed after them, hung delivery is not waited
+	// longer than abort timeout
+	app.deliveries.Add(1)
+	defer app.deliveries.Done()
+
+	app.runJob(app.sendDigests)
+	started := time.Now()
+	app.drain(started)
+
+	if waited := time.Since(started); waited > abortTimeout+time.Second {
+		t.Errorf("expected drain to give up on hung delivery, waited %v", waited)
+	}
+
+	if _, err := app.store.BufferedChats(store.OutboxBuffer); err == nil {
+		t.Error("expected state to be closed after drain")
+	}
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	router := newTestRouter(app)
+
+	get := func(path string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("expected JSON from %v, got %q", path, w.Body.String())
+		}
+
+		return w.Code, body
+	}
+
+	if code, body := get("/-/healthy"); code != http.StatusOK || body["status"] != "healthy" {
+		t.Errorf("expected healthy, got %d %v", code, body)
+	}
+
+	code, body := get("/-/ready")
+	checks := body["checks"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || checks["telegram"].(map[string]interface{})["ok"] != false {
+		t.Errorf("expected not ready before Telegram answered, got %d %v", code, body)
+	}
+
+	now := time.Now()
+	app.telegramChecked(now, nil)
+	app.bots["partner"].telegramChecked(now, nil)
+
+	if code, body := get("/-/ready"); code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("expected ready, got %d %v", code, body)
+	}
+
+	if check := app.telegramCheck(now.Add(3 * time.Minute)); check.OK {
+		t.Errorf("expected Telegram check to fail without recent getMe")
+	}
+
+	app.stats.AddPending(maxPendingDeliveries)
+	code, body = get("/-/ready")
+	checks = body["checks"].(map[string]interface{})
+	if code != http.StatusServiceUnavailable || checks["queue"].(map[string]interface{})["ok"] != false {
+		t.Errorf("expected not ready with saturated queue, got %d %v", code, body)
+	}
+	app.stats.AddPending(-maxPendingDeliveries)
+
+	app.config.Layouts["broken"] = "{{ .Alerts"
+	if check := app.templatesCheck(); check.OK || !strings.Contains(check.Error, "layouts.broken") {
+		t.Errorf("expected broken layout to fail readiness, got %+v", check)
+	}
+}
+
+func TestFakeTelegramManyMessages(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+	app.limiter = nil
+
+	pages := make([]*bytes.Buffer, 150)
+	for idx := range pages {
+		pages[idx] = bytes.NewBufferString(strconv.Itoa(idx))
+	}
+
+	app.SendPages(1, pages, SendOptions{})
+
+	if sent := fake.waitSent(t, 150); len(sent) != 150 {
+		t.Errorf("expected 150 messages, got %d", len(sent))
+	}
+}
+
+func TestCheckConfigCommand(t *testing.T) {
+	t.Setenv(appconfig.EnvPrefix+"_CONFIG_PATH", "")
+
+	cases := []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"-c", "pkg/appconfig/testdata/valid.yml"}, 0},
+		{[]string{"-c", "pkg/appconfig/testdata/dangling_layout.yml"}, 1},
+		{[]string{"-c", "testdata/missing.yml"}, 1},
+		{[]string{}, 2},
+	}
+
+	for _, c := range cases {
+		if code := checkConfigCommand(c.args); code != c.expected {
+			t.Errorf("expected exit code %d for %v, got %d", c.expected, c.args, code)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	fake := newFakeTelegram(t)
+	app := newTestApplication(t, fake)
+
+	records, err := recorder.ReadFile("testdata/recorded.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := new(bytes.Buffer)
+	delays := []time.Duration{}
+	app.replay(records, replayOptions{onlyChat: 1, speed: 10}, out, func(d time.Duration) { delays = append(delays, d) })
+
+	if fmt.Sprint(delays) != "[1s 2s]" {
+		t.Errorf("expected delays between records divided by speed, got %v", delays)
+	}
+
+	if count := strings.Count(out.String(), "=== "); count != 2 || strings.Contains(out.String(), "chat=2") {
+		t.Errorf("expected two pages for chat 1 only, got:\n%v", out.String())
+	}
+
+	if !strings.HasPrefix(out.String(), "=== 2024-05-01T10:00:00Z receiver=") {
+		t.Errorf("expected page header with record time, got:\n%v", out.String())
+	}
+
+	// without speed records are replayed at once and sent to target chat
+	delays = nil
+	app.replay(records, replayOptions{targetChat: 7}, out, func(d time.Duration) { delays = append(delays, d) })
+
+	if sent := fake.waitSent(t, 4); len(delays) != 0 || sent[0].ChatID != "7" {
+		t.Errorf("expected records sent to target chat without delays, got %d delays, chat %v", len(delays), sent[0].ChatID)
+	}
+	// webhook without chat ids is routed by subscriptions, other bot renders its webhooks
+	withStore(t, app)
+	subscriptionMatchers, err := matcher.ParseAll([]string{"alertname=something_happend"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := app.store.AddSubscription(&store.Subscription{ChatID: 9, Matchers: subscriptionMatchers}); err != nil {
+		t.Fatal(err)
+	}
+
+	subscribed := records[0]
+	subscribed.Path = "/alert"
+	subscribed.ChatIDs = nil
+
+	other := records[0]
+	other.Bot = "partner"
+
+	out.Reset()
+	app.replay([]recorder.Record{subscribed, other}, replayOptions{}, out, nil)
+
+	if !strings.Contains(out.String(), "chat=9 page=0") || strings.Count(out.String(), "=== ") != 2 {
+		t.Errorf("expected webhook to be routed by subscription and by other bot, got:\n%v", out.String())
+	}
+
+	other.Bot = "unknown"
+	out.Reset()
+	app.replay([]recorder.Record{other}, replayOptions{}, out, nil)
+
+	if out.Len() != 0 {
+		t.Errorf("expected record of unknown bot to be skipped, got:\n%v", out.String())
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+const mutesCheckInterval = time.Minute
+
+// chatMute returns active mute of chat, nil when chat is not muted
+func (app *Application) chatMute(chatID int64, now time.Time) *store.Mute {
+	if app.store == nil {
+		return nil
+	}
+
+	mute, err := app.store.Mute(chatID)
+	if err != nil {
+		log.Println("Error while reading mute:", chatID, err)
+		return nil
+	}
+
+	if mute == nil || !mute.Until.After(now) {
+		return nil
+	}
+
+	return mute
+}
+
+// splitMutedAlerts separates alerts matching chat mute. Returned groups are nil when empty
+func (app *Application) splitMutedAlerts(alerts *Alerts, chatID int64, now time.Time) (notify *Alerts, muted *Alerts) {
+	mute := app.chatMute(chatID, now)
+	if mute == nil {
+		return alerts, nil
+	}
+
+	other := make([]Alert, 0)
+	matched := make([]Alert, 0)
+
+	for _, alert := range alerts.Alerts {
+		if mute.Matchers.Match(alert.StringLabels()) {
+			matched = append(matched, alert)
+		} else {
+			other = append(other, alert)
+		}
+	}
+
+	if len(other) > 0 {
+		notify = alerts.WithAlerts(other)
+	}
+
+	if len(matched) > 0 {
+		muted = alerts.WithAlerts(matched)
+	}
+
+	return
+}
+
+func (app *Application) handleMutedAlerts(alerts *Alerts, chatID int64) {
+	if app.config.MuteAction == appconfig.MuteActionDrop {
+		if app.config.Debug {
+			log.Println("Dropped alerts in muted chat:", chatID, len(alerts.Alerts))
+		}
+
+		return
+	}
+
+	if err := app.bufferAlerts(store.MutedBuffer, alerts, chatID); err != nil {
+		log.Println("Error while saving muted alerts, dropping them:", chatID, err)
+	}
+}
+
+// sendMutedSummary sends alerts received while chat was muted as digest
+func (app *Application) sendMutedSummary(chatID int64, now time.Time) {
+	muted, err := app.store.TakeBuffered(store.MutedBuffer, chatID)
+	if err != nil {
+		log.Println("Error while taking muted alerts:", chatID, err)
+		return
+	}
+
+	if len(muted) == 0 || app.keepUndelivered(store.MutedBuffer, muted) {
+		return
+	}
+
+	view := app.buildDigest(muted, now)
+	view.Muted = true
+
+	app.sendDigest(chatID, view, SendOptions{})
+}
+
+// releaseMutes periodically unmutes chats whose mute is over
+func (app *Application) releaseMutes() {
+	app.every(mutesCheckInterval, app.flushMutes)
+}
+
+// flushMutes removes expired mutes and sends summary of alerts received while chat was muted
+func (app *Application) flushMutes(now time.Time) {
+	mutes, err := app.store.Mutes()
+	if err != nil {
+		log.Println("Error while reading mutes:", err)
+		return
+	}
+
+	muted := make(map[int64]bool)
+
+	for _, mute := range mutes {
+		if mute.Until.After(now) {
+			muted[mute.ChatID] = true
+			continue
+		}
+
+		if _, err := app.store.DeleteMute(mute.ChatID); err != nil {
+			log.Println("Error while removing mute:", mute.ChatID, err)
+			muted[mute.ChatID] = true
+		}
+	}
+
+	// summaries are sent for all unmuted chats, also ones kept on shutdown
+	chats, err := app.store.BufferedChats(store.MutedBuffer)
+	if err != nil {
+		log.Println("Error while reading muted alerts:", err)
+		return
+	}
+
+	for _, chat := range chats {
+		if !muted[chat.ChatID] {
+			app.sendMutedSummary(chat.ChatID, now)
+		}
+	}
+}
+
+func (app *Application) describeMute(mute *store.Mute) string {
+	text := fmt.Sprintf("until %v", app.formatTime(mute.Until))
+
+	if len(mute.Matchers) > 0 {
+		text += fmt.Sprintf(", alerts matching <code>%v</code>", html.EscapeString(mute.Matchers.String()))
+	} else {
+		text += ", all alerts"
+	}
+
+	return text
+}
+
+// muteCommand handles /mute 2h [matchers], without arguments shows current mute
+func (app *Application) muteCommand(message *tgbotapi.Message, args []string) {
+	if app.store == nil {
+		app.replyText(message, "Mutes are disabled, set <code>state_path</code> in config", nil)
+		return
+	}
+
+	now := time.Now()
+
+	if len(args) == 0 {
+		if mute := app.chatMute(message.Chat.ID, now); mute != nil {
+			app.replyText(message, "🔇 Chat is muted "+app.describeMute(mute), nil)
+		} else {
+			app.replyText(message, "Chat is not muted. Usage: <code>/mute 2h [matchers]</code>", nil)
+		}
+
+		return
+	}
+
+	duration, err := appconfig.ParseDuration(args[0])
+	if err != nil || duration <= 0 {
+		app.replyText(message, "Duration should be like <code>30m</code>, <code>2h</code> or <code>1d</code>", nil)
+		return
+	}
+
+	matchers, err := matcher.ParseAll(args[1:])
+	if err != nil {
+		app.replyText(message, html.EscapeString(err.Error()), nil)
+		return
+	}
+
+	mute := store.Mute{
+		ChatID:    message.Chat.ID,
+		Until:     now.Add(duration),
+		Matchers:  matchers,
+		CreatedBy: userName(message.From),
+		CreatedAt: now,
+	}
+
+	if err := app.store.PutMute(mute); err != nil {
+		log.Println("Error while saving mute:", message.Chat.ID, err)
+		app.replyText(message, "Cannot mute chat", nil)
+		return
+	}
+
+	text := "🔇 Chat muted " + app.describeMute(&mute)
+	if app.config.MuteAction == appconfig.MuteActionDrop {
+		text += ", muted alerts are dropped"
+	} else {
+		text += ", summary is sent on /unmute"
+	}
+
+	app.replyText(message, text, nil)
+}
+
+// unmuteCommand removes chat mute and sends summary of muted alerts
+func (app *Application) unmuteCommand(message *tgbotapi.Message, args []string) {
+	if app.store == nil {
+		app.replyText(message, "Mutes are disabled, set <code>state_path</code> in config", nil)
+		return
+	}
+
+	deleted, err := app.store.DeleteMute(message.Chat.ID)
+	if err != nil {
+		log.Println("Error while removing mute:", message.Chat.ID, err)
+		app.replyText(message, "Cannot unmute chat", nil)
+		return
+	}
+
+	if !deleted {
+		app.replyText(message, "Chat is not muted", nil)
+		return
+	}
+
+	app.replyText(message, fmt.Sprintf("🔔 Chat unmuted by %v", html.EscapeString(userName(message.From))), nil)
+
+	app.sendMutedSummary(message.Chat.ID, time.Now())
+}
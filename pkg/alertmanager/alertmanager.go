@@ -0,0 +1,140 @@
+package alertmanager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Client calls Alertmanager API v2
+type Client struct {
+	URL  string
+	HTTP *http.Client
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		URL:  strings.TrimSuffix(baseURL, "/"),
+		HTTP: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+type Matcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+	IsEqual bool   `json:"isEqual"`
+}
+
+// FromMatchers converts label matchers to silence matchers
+func FromMatchers(matchers matcher.Matchers) []Matcher {
+	result := make([]Matcher, 0, len(matchers))
+
+	for _, m := range matchers {
+		result = append(result, Matcher{Name: m.Name, Value: m.Value, IsRegex: m.IsRegex(), IsEqual: !m.IsNegative()})
+	}
+
+	return result
+}
+
+func (m Matcher) String() string {
+	op := matcher.Equal
+
+	switch {
+	case m.IsRegex && m.IsEqual:
+		op = matcher.Regexp
+	case m.IsRegex:
+		op = matcher.NotRegexp
+	case !m.IsEqual:
+		op = matcher.NotEqual
+	}
+
+	return fmt.Sprintf("%v%v%q", m.Name, op, m.Value)
+}
+
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+type Silence struct {
+	ID        string         `json:"id,omitempty"`
+	Matchers  []Matcher      `json:"matchers"`
+	StartsAt  time.Time      `json:"startsAt"`
+	EndsAt    time.Time      `json:"endsAt"`
+	CreatedBy string         `json:"createdBy"`
+	Comment   string         `json:"comment"`
+	Status    *SilenceStatus `json:"status,omitempty"`
+}
+
+func (s Silence) Active() bool {
+	return s.Status != nil && s.Status.State == "active"
+}
+
+// CreateSilence creates silence and returns its id
+func (c *Client) CreateSilence(silence Silence) (string, error) {
+	body, err := json.Marshal(silence)
+	if err != nil {
+		return "", err
+	}
+
+	result := struct {
+		SilenceID string `json:"silenceID"`
+	}{}
+
+	if err := c.do(http.MethodPost, "/api/v2/silences", bytes.NewReader(body), &result); err != nil {
+		return "", err
+	}
+
+	return result.SilenceID, nil
+}
+
+// Silences returns all silences known to Alertmanager, including expired
+func (c *Client) Silences() ([]Silence, error) {
+	silences := make([]Silence, 0)
+
+	return silences, c.do(http.MethodGet, "/api/v2/silences", nil, &silences)
+}
+
+func (c *Client) ExpireSilence(id string) error {
+	return c.do(http.MethodDelete, "/api/v2/silence/"+url.PathEscape(id), nil, nil)
+}
+
+func (c *Client) do(method string, path string, body io.Reader, result interface{}) error {
+	req, err := http.NewRequest(method, c.URL+path, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("alertmanager %v %v: %v %v", method, path, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	if result == nil || len(data) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(data, result)
+}
@@ -10,6 +10,11 @@ import (
 	configLoaderFile "github.com/micro/go-config/source/file"
 	"log"
 	"strings"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+	"github.com/pechorin/prometheus_tbot/pkg/runbook"
+	"github.com/pechorin/prometheus_tbot/pkg/schedule"
 )
 
 /*
@@ -45,17 +50,222 @@ type Config struct {
 	TimeZone          string            `json:"time_zone"`
 	TimeOutFormat     string            `json:"time_outdata"`
 	SplitMessageBytes int               `json:"split_msg_byte"`
+	SamplesPath       string            `json:"samples_path"`
+	RecordPath        string            `json:"record_path"`
+	StatePath         string            `json:"state_path"`
+	HistoryRetention  Duration          `json:"history_retention"`
+	SeverityLabel     string            `json:"severity_label"`
+	Severities        []string          `json:"severities"`
 
 	Layouts           map[string]string `json:"layouts"`
 	MessageTemplates  map[string]string `json:"message_templates"`
+	DigestTemplates   map[string]string `json:"digest_templates"`
+
+	ChatsLayouts      map[string]ChatLayout `json:"chats_layouts"`
+
+	Escalations []Escalation `json:"escalations"`
+	Watchdogs   []Watchdog   `json:"watchdogs"`
+
+	AlertmanagerURL string `json:"alertmanager_url"`
+	// графики выражений firing алертов, выключено без prometheus_url
+	Graph *Graph `json:"graph"`
+	// выдержки из runbook_url аннотаций алертов
+	Runbooks *Runbooks `json:"runbooks"`
+	// обновления от Telegram приходят вебхуком вместо long polling, если задано
+	TelegramWebhook *TelegramWebhook `json:"telegram_webhook"`
+	// Telegram user id пользователей, которым доступны все команды
+	AdminUserIDs []int `json:"admin_user_ids"`
+	// участники этих чатов получают роль member, при пустом списке ее получает любой написавший боту
+	MemberChatIDs []int64 `json:"member_chat_ids"`
+	// роли, переопределяющие роли команд по умолчанию, по имени команды
+	CommandPermissions map[string]Role `json:"command_permissions"`
+
+	// что делать с алертами в чатах, заглушенных командой /mute
+	MuteAction string `json:"mute_action"`
+
+	// повторы уже доставленного в чат уведомления за это время не отправляются, 0 - выключено
+	DedupWindow Duration `json:"dedup_window"`
+	DedupAction string   `json:"dedup_action"`
+
+	// дополнительные боты, вебхуки для них принимаются на /alert/<name>/<chat ids>
+	Bots []Bot `json:"bots"`
+
+	// несколько реплик за балансировщиком, выключено без cluster
+	Cluster *Cluster `json:"cluster"`
+
+	// сколько ждать доставки принятых уведомлений при остановке, недоставленные
+	// сохраняются в state_path и отправляются после запуска
+	ShutdownTimeout Duration `json:"shutdown_timeout"`
+
+	// запросов к Telegram API в секунду для одного бота, допускаются всплески того же размера
+	SendRate int `json:"send_rate"`
+
+	// ключи верхнего уровня из конфиг файла, нужны для проверки неизвестных ключей
+	rawKeys map[string]interface{}
+	// время чтения конфиг файла, показывается в /status и метриках
+	LoadedAt time.Time `json:"-"`
+}
+
+// ChatLayout описывает настройки рендера для отдельного чата из chats_layouts
+type ChatLayout struct {
+	Layout           string `json:"layout"`
+	MessageTemplate  string `json:"message_template"`
+	GroupByAlertName *bool  `json:"group_by_alert_name"`
+
+	// шаблоны строк firing и resolved алертов вместо message_template
+	FiringTemplate   string `json:"firing_template"`
+	ResolvedTemplate string `json:"resolved_template"`
+	// layouts уведомлений со статусом firing и resolved вместо layout
+	FiringLayout   string `json:"firing_layout"`
+	ResolvedLayout string `json:"resolved_layout"`
+
+	Schedule *schedule.Schedule `json:"schedule"`
+	Digest   *Digest            `json:"digest"`
+}
+
+const (
+	// алерты собираются и отправляются сводкой после /unmute
+	MuteActionSummarize = "summarize"
+	MuteActionDrop      = "drop"
+)
+
+const (
+	// повторы уведомления отбрасываются
+	DedupActionDrop = "drop"
+	// на первое сообщение отвечают коротким "still firing"
+	DedupActionReply = "reply"
+)
+
+// Role определяет, кто может выполнять команду бота
+type Role string
+
+const (
+	RoleEveryone Role = "everyone"
+	// участник чата из member_chat_ids
+	RoleMember Role = "member"
+	// администратор чата, в котором выполняется команда
+	RoleChatAdmin Role = "chat_admin"
+	// пользователь из admin_user_ids
+	RoleAdmin Role = "admin"
+)
+
+func (r Role) Valid() bool {
+	switch r {
+	case RoleEveryone, RoleMember, RoleChatAdmin, RoleAdmin:
+		return true
+	}
+
+	return false
+}
+
+// Escalation пересылает firing алерты, подходящие под matchers, в следующие чаты,
+// если их не подтвердили за время after уровня
+type Escalation struct {
+	Name     string           `json:"name"`
+	Matchers matcher.Matchers `json:"matchers"`
+	// чаты, для которых работает эскалация, пустой список - все чаты
+	Chats  []int64           `json:"chats"`
+	Levels []EscalationLevel `json:"levels"`
+}
+
+type EscalationLevel struct {
+	After Duration `json:"after"`
+	Chats []int64  `json:"chats"`
+}
+
+// Watchdog ждет от receiver постоянно горящий heartbeat алерт (Watchdog в kube-prometheus)
+// и сообщает в chats, если он не приходил дольше interval
+type Watchdog struct {
+	Receiver  string   `json:"receiver"`
+	AlertName string   `json:"alertname"`
+	Interval  Duration `json:"interval"`
+	Chats     []int64  `json:"chats"`
+}
+
+// TelegramWebhook регистрирует вебхук в Telegram на url + path. Telegram передает
+// secret_token в заголовке X-Telegram-Bot-Api-Secret-Token каждого запроса
+type TelegramWebhook struct {
+	// публичный адрес бота, например https://tbot.example.com
+	URL         string `json:"url"`
+	Path        string `json:"path"`
+	SecretToken string `json:"secret_token"`
+}
+
+// Endpoint возвращает адрес вебхука для setWebhook
+func (webhook *TelegramWebhook) Endpoint() string {
+	return strings.TrimSuffix(webhook.URL, "/") + webhook.Path
+}
+
+// Cluster - реплики координируются через общие файлы. Реплика, захватившая lock_path,
+// опрашивает Telegram, хранит состояние и выполняет фоновые задачи. Уведомление,
+// принятое несколькими репликами, отправляет первая, записавшая его в claims_path
+type Cluster struct {
+	LockPath   string `json:"lock_path"`
+	ClaimsPath string `json:"claims_path"`
+	// за это время повтор уведомления считается дублем от другой реплики
+	ClaimTTL Duration `json:"claim_ttl"`
+	// каталог, через который standby реплики передают вебхуки лидеру при заданном state_path.
+	// Без него standby отвечает 503 и вебхук повторяет Alertmanager
+	SpoolPath string `json:"spool_path"`
+}
+
+// Graph отправляет ответом на уведомление график выражения алерта из generatorURL
+// за последний range
+type Graph struct {
+	PrometheusURL string   `json:"prometheus_url"`
+	Range         Duration `json:"range"`
+	// не больше графиков на одно уведомление
+	MaxGraphs int `json:"max_graphs"`
+	Width     int `json:"width"`
+	Height    int `json:"height"`
+}
+
+// Runbooks отправляет ответом на уведомление раздел section из markdown runbook,
+// на который ссылается аннотация runbook_url
+type Runbooks struct {
+	Sources   []runbook.Source `json:"sources"`
+	Section   string           `json:"section"`
+	MaxLength int              `json:"max_length"`
+	CacheTTL  Duration         `json:"cache_ttl"`
+}
 
-	ChatsLayouts      map[string]map[string]string `json:"chats_layouts"`
+// Digest включает для чата периодическую сводку вместо отдельных сообщений
+type Digest struct {
+	Interval Duration `json:"interval"`
+	Template string   `json:"template"`
 }
 
 type SelectedLayout struct {
 	Layout          	string	`json:"layout"`
 	MessageTemplate  	string	`json:"message_template"`
 	GroupByAlertName	bool	`json:"group_by_alert_name"`
+	FiringTemplate  	string	`json:"firing_template"`
+	ResolvedTemplate	string	`json:"resolved_template"`
+	FiringLayout    	string	`json:"firing_layout"`
+	ResolvedLayout  	string	`json:"resolved_layout"`
+}
+
+// LayoutFor возвращает layout для уведомления со статусом status
+func (layout SelectedLayout) LayoutFor(status string) string {
+	if status == "resolved" && layout.ResolvedLayout != "" {
+		return layout.ResolvedLayout
+	}
+
+	if status != "resolved" && layout.FiringLayout != "" {
+		return layout.FiringLayout
+	}
+
+	return layout.Layout
+}
+
+// StatusTemplate возвращает firing_template или resolved_template для статуса алерта,
+// пустая строка - шаблон для статуса не задан
+func (layout SelectedLayout) StatusTemplate(status string) string {
+	if status == "resolved" {
+		return layout.ResolvedTemplate
+	}
+
+	return layout.FiringTemplate
 }
 
 // New() создает новый сетап конфига и инициализирует значения из:
@@ -103,18 +313,67 @@ func New() *Config {
 		app.Debug = newDebug
 	}
 	// merge from config file
+	yamlConfig, _ := loadFile(app.ConfigPath)
+
+	if err := app.scan(yamlConfig); err != nil {
+		fmt.Println("error while scan")
+		log.Fatal(err)
+	}
+
+	app.Finalize()
+
+	if app.Debug {
+		fmt.Printf("Config: %v\n", app)
+	}
+
+	if app.TelegramToken == "" {
+		log.Fatalln("No Telegram token provided")
+	}
+
+	return app
+}
+
+// Load() читает только конфиг файл, без флагов, env переменных и проверки токена.
+// Используется для проверки конфига перед деплоем
+func Load(path string) (*Config, error) {
+	app := new(Config)
+	app.ConfigPath = path
+
+	yamlConfig, err := loadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load config %v: %v", path, err)
+	}
+
+	if err := app.scan(yamlConfig); err != nil {
+		return nil, fmt.Errorf("cannot parse config %v: %v", path, err)
+	}
+
+	app.Finalize()
+
+	return app, nil
+}
+
+func loadFile(path string) (configLoader.Config, error) {
 	yamlConfig := configLoader.NewConfig()
 	yamlEncoderInstance := yamlEncoder.NewEncoder()
-	fileSrc := configLoaderFile.NewSource(configLoaderFile.WithPath(app.ConfigPath), configSource.WithEncoder(yamlEncoderInstance))
-	yamlConfig.Load(fileSrc)
+	fileSrc := configLoaderFile.NewSource(configLoaderFile.WithPath(path), configSource.WithEncoder(yamlEncoderInstance))
 
+	return yamlConfig, yamlConfig.Load(fileSrc)
+}
+
+func (app *Config) scan(yamlConfig configLoader.Config) error {
 	if err := yamlConfig.Scan(app); err != nil {
-		fmt.Println("error while scan")
-		log.Fatal(err)
+		return err
 	}
 
-	// finalize configuration
+	app.rawKeys = yamlConfig.Map()
+	app.LoadedAt = time.Now()
+
+	return nil
+}
 
+// Finalize заполняет значения по умолчанию
+func (app *Config) Finalize() {
 	if len(app.Layouts) == 0 {
 		if app.Layouts == nil {
 			app.Layouts = make(map[string]string)
@@ -131,6 +390,27 @@ func New() *Config {
 		app.MessageTemplates["prometheus"] = DefaultPrometheusMessageTemplate()
 	}
 
+	if app.DigestTemplates == nil {
+		app.DigestTemplates = make(map[string]string)
+	}
+
+	if _, ok := app.DigestTemplates["digest"]; !ok {
+		app.DigestTemplates["digest"] = DefaultDigestTemplate()
+	}
+
+	finalizeChatsLayouts(app.ChatsLayouts)
+	for _, bot := range app.Bots {
+		finalizeChatsLayouts(bot.ChatsLayouts)
+	}
+
+	if app.ShutdownTimeout.Duration == 0 {
+		app.ShutdownTimeout.Duration = 20 * time.Second
+	}
+
+	if app.SendRate == 0 {
+		app.SendRate = 30
+	}
+
 	if !strings.HasPrefix(app.Port, ":") {
 		app.Port = ":" + app.Port
 	}
@@ -139,15 +419,103 @@ func New() *Config {
 		app.SplitMessageBytes = 4000
 	}
 
-	if app.Debug {
-		fmt.Printf("Config: %v\n", app)
+	for idx := range app.Watchdogs {
+		if app.Watchdogs[idx].AlertName == "" {
+			app.Watchdogs[idx].AlertName = "Watchdog"
+		}
 	}
 
-	if app.TelegramToken == "" {
-		log.Fatalln("No Telegram token provided")
+	if app.TelegramWebhook != nil {
+		if app.TelegramWebhook.Path == "" {
+			app.TelegramWebhook.Path = "/telegram"
+		}
+
+		if !strings.HasPrefix(app.TelegramWebhook.Path, "/") {
+			app.TelegramWebhook.Path = "/" + app.TelegramWebhook.Path
+		}
 	}
 
-	return app
+	if app.Cluster != nil && app.Cluster.ClaimTTL.Duration == 0 {
+		app.Cluster.ClaimTTL.Duration = 5 * time.Minute
+	}
+
+	if app.Graph != nil {
+		if app.Graph.Range.Duration == 0 {
+			app.Graph.Range.Duration = time.Hour
+		}
+
+		if app.Graph.MaxGraphs == 0 {
+			app.Graph.MaxGraphs = 3
+		}
+
+		if app.Graph.Width == 0 {
+			app.Graph.Width = 800
+		}
+
+		if app.Graph.Height == 0 {
+			app.Graph.Height = 300
+		}
+	}
+
+	if app.Runbooks != nil {
+		if app.Runbooks.MaxLength == 0 {
+			app.Runbooks.MaxLength = 1000
+		}
+
+		if app.Runbooks.CacheTTL.Duration == 0 {
+			app.Runbooks.CacheTTL.Duration = 10 * time.Minute
+		}
+	}
+
+	if app.DedupAction == "" {
+		app.DedupAction = DedupActionDrop
+	}
+
+	if app.MuteAction == "" {
+		app.MuteAction = MuteActionSummarize
+	}
+
+	if app.SamplesPath == "" {
+		app.SamplesPath = "testdata"
+	}
+
+	if app.HistoryRetention.Duration == 0 {
+		app.HistoryRetention.Duration = 30 * 24 * time.Hour
+	}
+
+	if app.SeverityLabel == "" {
+		app.SeverityLabel = "severity"
+	}
+
+	if len(app.Severities) == 0 {
+		app.Severities = []string{"info", "warning", "error", "critical"}
+	}
+}
+
+func finalizeChatsLayouts(chatsLayouts map[string]ChatLayout) {
+	for _, chatLayout := range chatsLayouts {
+		if chatLayout.Digest != nil {
+			if chatLayout.Digest.Template == "" {
+				chatLayout.Digest.Template = "digest"
+			}
+
+			if chatLayout.Digest.Interval.Duration == 0 {
+				chatLayout.Digest.Interval.Duration = time.Hour
+			}
+		}
+	}
+}
+
+// SeverityRank возвращает позицию severity в списке severities, от менее важных к более важным.
+// Для неизвестных значений возвращается -1
+func (app *Config) SeverityRank(severity string) int {
+	for idx, known := range app.Severities {
+		if strings.EqualFold(known, severity) {
+			return idx
+		}
+	}
+
+	return -1
 }
 
 func DefaultPrometheusLayout() string {
@@ -178,6 +546,32 @@ func DefaultPrometheusGroupLabelTemplate() string {
 `
 }
 
+func DefaultDigestTemplate() string {
+	return `
+{{- if .Held }}🌙 <b>Held during quiet hours</b>{{ else if .Muted }}🔇 <b>Received while muted</b>{{ else }}📋 <b>Digest</b>{{ end }} {{ FormatTime .Since }} - {{ FormatTime .Until }}
+{{ .Notifications }} notifications, {{ len .Firing }} firing{{ if .Acked }} ({{ len .Acked }} acked){{ end }}, {{ len .Resolved }} resolved
+{{ if .ByAlertName }}
+<b>By alertname</b>
+{{ range .ByAlertName }}<code>{{ .Name }}</code>: {{ .Count }}
+{{ end }}{{ end }}
+{{- if .BySeverity }}
+<b>By severity</b>
+{{ range .BySeverity }}{{ .Name }}: {{ .Count }}
+{{ end }}{{ end }}
+{{- if .TopOffenders }}
+<b>Top offenders</b>
+{{ range .TopOffenders }}<code>{{ .Alert.Labels.alertname }}</code>{{ with .Alert.Labels.instance }} {{ . }}{{ end }}: {{ .Count }}
+{{ end }}{{ end }}
+{{- if .Acked }}
+<b>Acknowledged</b>
+{{ range .Acked }}<code>{{ .Alert.Labels.alertname }}</code>{{ with .Alert.Labels.instance }} {{ . }}{{ end }} 👀 {{ .AckedBy }}
+{{ end }}{{ end }}
+{{- if .Resolved }}
+<b>Resolved</b>
+{{ range .Resolved }}<code>{{ .Labels.alertname }}</code>{{ with .Labels.instance }} {{ . }}{{ end }}
+{{ end }}{{ end }}`
+}
+
 func PrometheusMessagesWrapperTemplate() string {
 	return `
 {{ define "messages" }}
@@ -0,0 +1,102 @@
+package appconfig
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Bot - дополнительный бот в том же процессе со своим токеном, шаблонами и чатами.
+// Незаданные поля берутся из основного конфига
+type Bot struct {
+	Name          string `json:"name"`
+	TelegramToken string `json:"telegram_token"`
+
+	// дополняют и переопределяют шаблоны основного конфига
+	Layouts          map[string]string `json:"layouts"`
+	MessageTemplates map[string]string `json:"message_templates"`
+	DigestTemplates  map[string]string `json:"digest_templates"`
+
+	// заменяют настройки основного конфига, если заданы
+	ChatsLayouts       map[string]ChatLayout `json:"chats_layouts"`
+	AdminUserIDs       []int                 `json:"admin_user_ids"`
+	MemberChatIDs      []int64               `json:"member_chat_ids"`
+	CommandPermissions map[string]Role       `json:"command_permissions"`
+	Escalations        []Escalation          `json:"escalations"`
+	AlertmanagerURL    string                `json:"alertmanager_url"`
+}
+
+// BotConfig возвращает конфиг бота. Состояние и запись вебхуков бота хранятся
+// в отдельных файлах с именем бота: state.db -> state.<name>.db
+func (app *Config) BotConfig(bot Bot) *Config {
+	config := *app
+
+	config.TelegramToken = bot.TelegramToken
+	config.Bots = nil
+	// watchdogs работают только в основном боте
+	config.Watchdogs = nil
+
+	config.Layouts = mergeTemplates(app.Layouts, bot.Layouts)
+	config.MessageTemplates = mergeTemplates(app.MessageTemplates, bot.MessageTemplates)
+	config.DigestTemplates = mergeTemplates(app.DigestTemplates, bot.DigestTemplates)
+
+	if bot.ChatsLayouts != nil {
+		config.ChatsLayouts = bot.ChatsLayouts
+	}
+
+	if bot.AdminUserIDs != nil {
+		config.AdminUserIDs = bot.AdminUserIDs
+	}
+
+	if bot.MemberChatIDs != nil {
+		config.MemberChatIDs = bot.MemberChatIDs
+	}
+
+	if bot.CommandPermissions != nil {
+		config.CommandPermissions = bot.CommandPermissions
+	}
+
+	if bot.Escalations != nil {
+		config.Escalations = bot.Escalations
+	}
+
+	if bot.AlertmanagerURL != "" {
+		config.AlertmanagerURL = bot.AlertmanagerURL
+	}
+
+	// вебхук бота принимается на <path>/<name>
+	if app.TelegramWebhook != nil {
+		webhook := *app.TelegramWebhook
+		webhook.Path = strings.TrimSuffix(webhook.Path, "/") + "/" + bot.Name
+		config.TelegramWebhook = &webhook
+	}
+
+	config.StatePath = botPath(app.StatePath, bot.Name)
+	config.RecordPath = botPath(app.RecordPath, bot.Name)
+
+	return &config
+}
+
+func mergeTemplates(base map[string]string, override map[string]string) map[string]string {
+	merged := make(map[string]string, len(base)+len(override))
+
+	for name, text := range base {
+		merged[name] = text
+	}
+
+	for name, text := range override {
+		merged[name] = text
+	}
+
+	return merged
+}
+
+// botPath добавляет имя бота перед расширением файла
+func botPath(path string, name string) string {
+	if path == "" {
+		return ""
+	}
+
+	ext := filepath.Ext(path)
+
+	return strings.TrimSuffix(path, ext) + "." + name + ext
+}
@@ -0,0 +1,62 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration читается из конфига строкой вида "90s", "1h30m", "7d" или "2w"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case string:
+		parsed, err := ParseDuration(v)
+		if err != nil {
+			return err
+		}
+
+		d.Duration = parsed
+	case float64:
+		// число без единиц - секунды
+		d.Duration = time.Duration(v * float64(time.Second))
+	case nil:
+		d.Duration = 0
+	default:
+		return fmt.Errorf("invalid duration %v", value)
+	}
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// ParseDuration расширяет time.ParseDuration суффиксами d (дни) и w (недели)
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if strings.HasSuffix(s, suffix) {
+			count, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+
+			return time.Duration(count * float64(unit)), nil
+		}
+	}
+
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,425 @@
+package appconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/schedule"
+)
+
+// Telegram принимает secret_token только из этих символов
+var secretTokenRe = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// Частые ошибки в именах ключей и их правильные варианты
+var keyHints = map[string]string{
+	"messages_layouts":      "message_templates",
+	"template_time_zone":    "time_zone",
+	"template_time_outdata": "time_outdata",
+	"split_msg_bytes":       "split_msg_byte",
+}
+
+// Validate проверяет загруженный конфиг: неизвестные ключи, синтаксис шаблонов,
+// ссылки из chats_layouts на несуществующие шаблоны и часовой пояс.
+// funcs должны совпадать с функциями, доступными шаблонам при рендере
+func (app *Config) Validate(funcs textTemplate.FuncMap) []error {
+	errs := make([]error, 0)
+
+	errs = append(errs, nestedUnknownKeys("", app.rawKeys, reflect.TypeOf(Config{}))...)
+
+	for _, name := range sortedKeys(app.Layouts) {
+		tmpl := textTemplate.New(name).Funcs(funcs)
+		if _, err := tmpl.Parse(app.Layouts[name]); err != nil {
+			errs = append(errs, fmt.Errorf("layouts.%v: %v", name, err))
+		}
+	}
+
+	for _, name := range sortedKeys(app.MessageTemplates) {
+		tmpl := textTemplate.New(name).Funcs(funcs)
+		if _, err := tmpl.Parse(app.MessageTemplates[name]); err != nil {
+			errs = append(errs, fmt.Errorf("message_templates.%v: %v", name, err))
+		}
+	}
+
+	for _, name := range sortedKeys(app.DigestTemplates) {
+		tmpl := textTemplate.New(name).Funcs(funcs)
+		if _, err := tmpl.Parse(app.DigestTemplates[name]); err != nil {
+			errs = append(errs, fmt.Errorf("digest_templates.%v: %v", name, err))
+		}
+	}
+
+	errs = append(errs, app.validateChatsLayouts("")...)
+
+	botNames := make(map[string]bool)
+	for idx, bot := range app.Bots {
+		prefix := fmt.Sprintf("bots[%d]", idx)
+		if bot.Name != "" {
+			prefix = fmt.Sprintf("bots.%v", bot.Name)
+		}
+
+		if bot.Name == "" {
+			errs = append(errs, fmt.Errorf("%v.name: name is required", prefix))
+		} else if _, err := strconv.ParseInt(bot.Name, 10, 64); err == nil || strings.Contains(bot.Name, "/") {
+			errs = append(errs, fmt.Errorf("%v.name: name should not be a number or contain /, it is part of webhook URL", prefix))
+		} else if botNames[bot.Name] {
+			errs = append(errs, fmt.Errorf("%v.name: bot is defined several times", prefix))
+		}
+		botNames[bot.Name] = true
+
+		if bot.TelegramToken == "" {
+			errs = append(errs, fmt.Errorf("%v.telegram_token: token is required", prefix))
+		}
+
+		if bot.ChatsLayouts != nil {
+			errs = append(errs, app.BotConfig(bot).validateChatsLayouts(prefix+".")...)
+		}
+	}
+
+	for idx, escalation := range app.Escalations {
+		prefix := fmt.Sprintf("escalations[%d]", idx)
+		if escalation.Name != "" {
+			prefix = fmt.Sprintf("escalations.%v", escalation.Name)
+		}
+
+		if escalation.Name == "" {
+			errs = append(errs, fmt.Errorf("%v.name: name is required", prefix))
+		}
+
+		if len(escalation.Levels) == 0 {
+			errs = append(errs, fmt.Errorf("%v.levels: at least one level is required", prefix))
+		}
+
+		for levelIdx, level := range escalation.Levels {
+			if len(level.Chats) == 0 {
+				errs = append(errs, fmt.Errorf("%v.levels[%d].chats: at least one chat is required", prefix, levelIdx))
+			}
+
+			if level.After.Duration <= 0 {
+				errs = append(errs, fmt.Errorf("%v.levels[%d].after: should be positive", prefix, levelIdx))
+			}
+
+			if levelIdx > 0 && level.After.Duration <= escalation.Levels[levelIdx-1].After.Duration {
+				errs = append(errs, fmt.Errorf("%v.levels[%d].after: should be greater than previous level", prefix, levelIdx))
+			}
+		}
+
+		if app.StatePath == "" {
+			errs = append(errs, fmt.Errorf("%v: escalations require state_path", prefix))
+		}
+	}
+
+	watchdogReceivers := make(map[string]bool)
+	for idx, watchdog := range app.Watchdogs {
+		prefix := fmt.Sprintf("watchdogs[%d]", idx)
+		if watchdog.Receiver != "" {
+			prefix = fmt.Sprintf("watchdogs.%v", watchdog.Receiver)
+		}
+
+		if watchdog.Receiver == "" {
+			errs = append(errs, fmt.Errorf("%v.receiver: receiver is required", prefix))
+		} else if watchdogReceivers[watchdog.Receiver] {
+			errs = append(errs, fmt.Errorf("%v.receiver: receiver has several watchdogs", prefix))
+		}
+		watchdogReceivers[watchdog.Receiver] = true
+
+		if watchdog.Interval.Duration < time.Minute {
+			errs = append(errs, fmt.Errorf("%v.interval: should be at least 1m", prefix))
+		}
+
+		if len(watchdog.Chats) == 0 {
+			errs = append(errs, fmt.Errorf("%v.chats: at least one chat is required", prefix))
+		}
+	}
+
+	if app.AlertmanagerURL != "" {
+		if parsed, err := url.Parse(app.AlertmanagerURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("alertmanager_url: should be absolute URL like http://alertmanager:9093"))
+		}
+	}
+
+	if app.TelegramWebhook != nil {
+		if parsed, err := url.Parse(app.TelegramWebhook.URL); err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("telegram_webhook.url: should be public https URL like https://tbot.example.com"))
+		}
+
+		if !secretTokenRe.MatchString(app.TelegramWebhook.SecretToken) {
+			errs = append(errs, fmt.Errorf("telegram_webhook.secret_token: should be 1-256 characters A-Z, a-z, 0-9, _ and -"))
+		}
+
+		if path := app.TelegramWebhook.Path; path == "/alert" || path == "/metrics" || strings.HasPrefix(path, "/alert/") || strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/-/") {
+			errs = append(errs, fmt.Errorf("telegram_webhook.path: %v conflicts with bot routes", app.TelegramWebhook.Path))
+		}
+	}
+
+	if app.Cluster != nil {
+		if app.Cluster.LockPath == "" {
+			errs = append(errs, fmt.Errorf("cluster.lock_path: lock file is required"))
+		}
+
+		if app.Cluster.ClaimsPath == "" {
+			errs = append(errs, fmt.Errorf("cluster.claims_path: claims directory is required"))
+		}
+
+		if app.Cluster.ClaimTTL.Duration < time.Minute {
+			errs = append(errs, fmt.Errorf("cluster.claim_ttl: should be at least 1m"))
+		}
+	}
+
+	if app.Graph != nil {
+		if parsed, err := url.Parse(app.Graph.PrometheusURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			errs = append(errs, fmt.Errorf("graph.prometheus_url: should be absolute URL like http://prometheus:9090"))
+		}
+
+		if app.Graph.Range.Duration < time.Minute {
+			errs = append(errs, fmt.Errorf("graph.range: should be at least 1m"))
+		}
+
+		if app.Graph.MaxGraphs < 0 {
+			errs = append(errs, fmt.Errorf("graph.max_graphs: should not be negative"))
+		}
+
+		if app.Graph.Width < 100 || app.Graph.Height < 100 || app.Graph.Width > 2000 || app.Graph.Height > 2000 {
+			errs = append(errs, fmt.Errorf("graph: width and height should be between 100 and 2000"))
+		}
+	}
+
+	if app.Runbooks != nil {
+		if len(app.Runbooks.Sources) == 0 {
+			errs = append(errs, fmt.Errorf("runbooks.sources: at least one source is required"))
+		}
+
+		for idx, source := range app.Runbooks.Sources {
+			if source.Prefix == "" {
+				errs = append(errs, fmt.Errorf("runbooks.sources[%d].prefix: prefix is required", idx))
+			}
+
+			if (source.Path == "") == (source.URL == "") {
+				errs = append(errs, fmt.Errorf("runbooks.sources[%d]: exactly one of path or url is required", idx))
+			}
+		}
+
+		// раздел отправляется отдельным сообщением, после экранирования он обрезается до лимита Telegram
+		if app.Runbooks.MaxLength < 1 || app.Runbooks.MaxLength > 3500 {
+			errs = append(errs, fmt.Errorf("runbooks.max_length: should be between 1 and 3500"))
+		}
+	}
+
+	for _, command := range sortedKeys(app.CommandPermissions) {
+		if role := app.CommandPermissions[command]; !role.Valid() {
+			errs = append(errs, fmt.Errorf("command_permissions.%v: unknown role %q, expected one of everyone, member, chat_admin, admin", command, role))
+		}
+	}
+
+	if app.MuteAction != MuteActionSummarize && app.MuteAction != MuteActionDrop {
+		errs = append(errs, fmt.Errorf("mute_action: unknown action %q, expected summarize or drop", app.MuteAction))
+	}
+
+	if app.DedupWindow.Duration < 0 {
+		errs = append(errs, fmt.Errorf("dedup_window: should not be negative"))
+	}
+
+	if app.DedupAction != DedupActionDrop && app.DedupAction != DedupActionReply {
+		errs = append(errs, fmt.Errorf("dedup_action: unknown action %q, expected drop or reply", app.DedupAction))
+	}
+
+	if app.ShutdownTimeout.Duration < 0 {
+		errs = append(errs, fmt.Errorf("shutdown_timeout: should not be negative"))
+	}
+
+	if app.SendRate < 0 {
+		errs = append(errs, fmt.Errorf("send_rate: should not be negative"))
+	}
+
+	if app.TimeZone != "" {
+		if _, err := time.LoadLocation(app.TimeZone); err != nil {
+			errs = append(errs, fmt.Errorf("time_zone: %v", err))
+		}
+	}
+
+	if app.SplitMessageBytes < 0 || app.SplitMessageBytes > 4096 {
+		errs = append(errs, fmt.Errorf("split_msg_byte: should be between 1 and 4096, Telegram message limit"))
+	}
+
+	return errs
+}
+
+// validateChatsLayouts проверяет ссылки chats_layouts на шаблоны, prefix добавляется к ключам ошибок
+func (app *Config) validateChatsLayouts(prefix string) []error {
+	errs := make([]error, 0)
+
+	for _, chatID := range sortedKeys(app.ChatsLayouts) {
+		chatLayout := app.ChatsLayouts[chatID]
+
+		if _, err := strconv.ParseInt(chatID, 10, 64); err != nil {
+			errs = append(errs, fmt.Errorf("%vchats_layouts.%v: chat id should be integer", prefix, chatID))
+		}
+
+		layouts := []struct{ key, name string }{
+			{"layout", chatLayout.Layout},
+			{"firing_layout", chatLayout.FiringLayout},
+			{"resolved_layout", chatLayout.ResolvedLayout},
+		}
+
+		for _, layout := range layouts {
+			if _, ok := app.Layouts[layout.name]; layout.name != "" && !ok {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.%v: layout %q is not defined", prefix, chatID, layout.key, layout.name))
+			}
+		}
+
+		messageTemplates := []struct{ key, name string }{
+			{"message_template", chatLayout.MessageTemplate},
+			{"firing_template", chatLayout.FiringTemplate},
+			{"resolved_template", chatLayout.ResolvedTemplate},
+		}
+
+		for _, messageTemplate := range messageTemplates {
+			if _, ok := app.MessageTemplates[messageTemplate.name]; messageTemplate.name != "" && !ok {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.%v: message template %q is not defined", prefix, chatID, messageTemplate.key, messageTemplate.name))
+			}
+		}
+
+		if chatLayout.Schedule != nil {
+			// чат без часов расписания молчал бы всегда
+			if len(chatLayout.Schedule.Hours) == 0 {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.schedule.hours: at least one range is required", prefix, chatID))
+			}
+
+			if chatLayout.Schedule.MinSeverity != "" && app.SeverityRank(chatLayout.Schedule.MinSeverity) < 0 {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.schedule.min_severity: %q is not listed in severities %v", prefix, chatID, chatLayout.Schedule.MinSeverity, app.Severities))
+			}
+
+			if chatLayout.Schedule.QuietAction == schedule.ActionHold && app.StatePath == "" {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.schedule.quiet_action: hold requires state_path", prefix, chatID))
+			}
+		}
+
+		if chatLayout.Digest != nil {
+			if _, ok := app.DigestTemplates[chatLayout.Digest.Template]; !ok {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.digest.template: digest template %q is not defined", prefix, chatID, chatLayout.Digest.Template))
+			}
+
+			if chatLayout.Digest.Interval.Duration < time.Minute {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.digest.interval: should be at least 1m", prefix, chatID))
+			}
+
+			if app.StatePath == "" {
+				errs = append(errs, fmt.Errorf("%vchats_layouts.%v.digest: digest requires state_path", prefix, chatID))
+			}
+		}
+	}
+
+	return errs
+}
+
+// типы со своим UnmarshalJSON читаются не по json тегам полей
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// nestedUnknownKeys ищет неизвестные ключи в raw и во вложенных объектах, списках
+// и словарях по структуре t. path - путь к raw в конфиге, пустой для корня
+func nestedUnknownKeys(path string, raw interface{}, t reflect.Type) []error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	errs := make([]error, 0)
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		prefix := ""
+		if path != "" {
+			prefix = path + "."
+		}
+
+		errs = append(errs, unknownKeys(prefix, fields, jsonKeys(t))...)
+
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+
+			if value, ok := fields[name]; ok && name != "" && name != "-" {
+				errs = append(errs, nestedUnknownKeys(prefix+name, value, t.Field(i).Type)...)
+			}
+		}
+	case reflect.Slice:
+		items, ok := raw.([]interface{})
+		if !ok {
+			return nil
+		}
+
+		for idx, item := range items {
+			errs = append(errs, nestedUnknownKeys(fmt.Sprintf("%v[%d]", path, idx), item, t.Elem())...)
+		}
+	case reflect.Map:
+		values, ok := raw.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+
+		for _, key := range sortedKeys(values) {
+			errs = append(errs, nestedUnknownKeys(path+"."+key, values[key], t.Elem())...)
+		}
+	}
+
+	return errs
+}
+
+func unknownKeys(prefix string, raw map[string]interface{}, known map[string]bool) []error {
+	errs := make([]error, 0)
+
+	for _, key := range sortedKeys(raw) {
+		if known[key] {
+			continue
+		}
+
+		if hint, ok := keyHints[key]; ok {
+			errs = append(errs, fmt.Errorf("%v%v: unknown key, did you mean %q?", prefix, key, hint))
+		} else {
+			errs = append(errs, fmt.Errorf("%v%v: unknown key", prefix, key))
+		}
+	}
+
+	return errs
+}
+
+// jsonKeys возвращает имена полей структуры из json тегов
+func jsonKeys(t reflect.Type) map[string]bool {
+	keys := make(map[string]bool)
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+
+	return keys
+}
+
+func sortedKeys(dict interface{}) []string {
+	keys := make([]string, 0)
+
+	for _, key := range reflect.ValueOf(dict).MapKeys() {
+		keys = append(keys, key.String())
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,85 @@
+package appconfig
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	textTemplate "text/template"
+)
+
+// templateFuncs - функции, доступные шаблонам. Parse проверяет только их имена
+var templateFuncs = textTemplate.FuncMap{
+	"FormatDate":        fmt.Sprint,
+	"ToUpper":           strings.ToUpper,
+	"ToLower":           strings.ToLower,
+	"Title":             strings.Title,
+	"FormatFloat":       fmt.Sprint,
+	"FormatByte":        fmt.Sprint,
+	"FormatMeasureUnit": fmt.Sprint,
+	"HasKey":            fmt.Sprint,
+	"FormatTime":        fmt.Sprint,
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		file     string
+		expected []string
+	}{
+		{"valid.yml", nil},
+		{"hint.yml", []string{
+			`messages_layouts: unknown key, did you mean "message_templates"?`,
+		}},
+		{"bad_template.yml", []string{
+			"layouts.broken: template: broken:1: unclosed action",
+			`message_templates.unknown_func: template: unknown_func:1: function "Shout" not defined`,
+		}},
+		{"dangling_layout.yml", []string{
+			`chats_layouts.1.layout: layout "missing" is not defined`,
+			`chats_layouts.1.message_template: message template "missing_row" is not defined`,
+		}},
+		{"bad_time_zone.yml", []string{
+			"time_zone: unknown time zone Mars/Olympus",
+		}},
+		{"nested_keys.yml", []string{
+			"chats_layouts.1.digest.every: unknown key",
+			"escalations[0].levels[0].repeat: unknown key",
+			"watchdogs[0].alert_name: unknown key",
+			"graph.max_graph: unknown key",
+			"runbooks.section_name: unknown key",
+			"runbooks.sources[0].dir: unknown key",
+			"bots[0].admin_users: unknown key",
+		}},
+		{"bad_schedule.yml", []string{
+			"chats_layouts.1.schedule.hours: at least one range is required",
+		}},
+		{"bad_escalation.yml", []string{
+			"escalations.night.levels[1].chats: at least one chat is required",
+			"escalations.night.levels[1].after: should be greater than previous level",
+		}},
+		{"bad_watchdog.yml", []string{
+			"watchdogs.heartbeat.interval: should be at least 1m",
+			"watchdogs.heartbeat.chats: at least one chat is required",
+			"watchdogs.heartbeat.receiver: receiver has several watchdogs",
+		}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.file, func(t *testing.T) {
+			config, err := Load("testdata/" + c.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errs := config.Validate(templateFuncs)
+
+			actual := make([]string, 0, len(errs))
+			for _, err := range errs {
+				actual = append(actual, err.Error())
+			}
+
+			if strings.Join(actual, "\n") != strings.Join(c.expected, "\n") {
+				t.Errorf("expected errors:\n%v\ngot:\n%v", strings.Join(c.expected, "\n"), strings.Join(actual, "\n"))
+			}
+		})
+	}
+}
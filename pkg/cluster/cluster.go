@@ -0,0 +1,181 @@
+// Package cluster coordinates replicas of bot running behind load balancer: one replica
+// holds leader lock, notification accepted by several replicas is sent by one of them
+package cluster
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lock is held by leader replica until it exits
+type Lock interface {
+	// TryLock takes lock without waiting, returns false when lock is held by other replica
+	TryLock() (bool, error)
+}
+
+// Claims records notifications taken for delivery by replicas
+type Claims interface {
+	// Claim returns true when key was not claimed during ttl, by this or other replica
+	Claim(key string, now time.Time) (bool, error)
+}
+
+// WaitLeader blocks until lock is taken, retrying every interval. Returns false when
+// done is closed before lock is taken
+func WaitLeader(lock Lock, interval time.Duration, done <-chan struct{}, onError func(error)) bool {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := lock.TryLock()
+		if err != nil {
+			onError(err)
+		}
+
+		if ok {
+			return true
+		}
+
+		select {
+		case <-done:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// FileClaims keeps claims as files in directory shared by replicas on one host
+// or on shared volume. Claim file is locked with flock while it is read and written
+type FileClaims struct {
+	dir string
+	ttl time.Duration
+
+	mu       sync.Mutex
+	prunedAt time.Time
+}
+
+func NewFileClaims(dir string, ttl time.Duration) (*FileClaims, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileClaims{dir: dir, ttl: ttl}, nil
+}
+
+func (claims *FileClaims) Claim(key string, now time.Time) (bool, error) {
+	claims.prune(now)
+
+	sum := sha256.Sum256([]byte(key))
+
+	file, err := lockClaim(filepath.Join(claims.dir, hex.EncodeToString(sum[:])))
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	claimedAt, err := readClaim(file)
+	if err != nil {
+		return false, err
+	}
+
+	if !claimedAt.IsZero() && now.Sub(claimedAt) < claims.ttl {
+		return false, nil
+	}
+
+	// new or expired claim is taken under lock, so only one replica gets true
+	if err := file.Truncate(0); err != nil {
+		return false, err
+	}
+
+	if _, err := file.WriteAt([]byte(strconv.FormatInt(now.UnixNano(), 10)), 0); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// lockClaim opens claim file and takes its lock, lock is released when file is closed
+func lockClaim(path string) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := flock(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		// claim could be pruned while waiting for lock, its file is not used anymore
+		locked, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(locked, current) {
+			return file, nil
+		}
+
+		file.Close()
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+}
+
+// readClaim returns time of claim, zero for new claim file
+func readClaim(file *os.File) (time.Time, error) {
+	data, err := ioutil.ReadAll(io.NewSectionReader(file, 0, 64))
+	if err != nil || len(data) == 0 {
+		return time.Time{}, err
+	}
+
+	nanos, err := strconv.ParseInt(string(data), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, nanos), nil
+}
+
+// prune removes expired claims once in ttl
+func (claims *FileClaims) prune(now time.Time) {
+	claims.mu.Lock()
+	if now.Sub(claims.prunedAt) < claims.ttl {
+		claims.mu.Unlock()
+		return
+	}
+	claims.prunedAt = now
+	claims.mu.Unlock()
+
+	files, err := ioutil.ReadDir(claims.dir)
+	if err != nil {
+		return
+	}
+
+	for _, info := range files {
+		path := filepath.Join(claims.dir, info.Name())
+
+		file, err := lockClaim(path)
+		if err != nil {
+			continue
+		}
+
+		// claim is removed under lock, replicas waiting for it open new file
+		if claimedAt, err := readClaim(file); err == nil && now.Sub(claimedAt) >= claims.ttl {
+			os.Remove(path)
+		}
+
+		file.Close()
+	}
+}
@@ -0,0 +1,145 @@
+package cluster
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFileLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tbot.lock")
+
+	leader := NewFileLock(path)
+	if ok, err := leader.TryLock(); !ok || err != nil {
+		t.Fatalf("expected first replica to take lock, got %v %v", ok, err)
+	}
+
+	standby := NewFileLock(path)
+	if ok, err := standby.TryLock(); ok || err != nil {
+		t.Errorf("expected second replica to wait for lock, got %v %v", ok, err)
+	}
+
+	if ok, _ := leader.TryLock(); !ok {
+		t.Errorf("expected leader to keep lock")
+	}
+}
+
+func TestFileClaims(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	first, err := NewFileClaims(dir, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := NewFileClaims(dir, time.Minute)
+
+	if ok, err := first.Claim("group/abc", now); !ok || err != nil {
+		t.Fatalf("expected notification to be claimed, got %v %v", ok, err)
+	}
+
+	if ok, _ := second.Claim("group/abc", now.Add(time.Second)); ok {
+		t.Errorf("expected notification claimed by other replica to be skipped")
+	}
+
+	if ok, _ := second.Claim("group/def", now); !ok {
+		t.Errorf("expected other notification to be claimed")
+	}
+
+	if ok, _ := second.Claim("group/abc", now.Add(2*time.Minute)); !ok {
+		t.Errorf("expected expired claim to be taken again")
+	}
+}
+
+func TestFileClaimsConcurrentTakeover(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	first, _ := NewFileClaims(dir, time.Minute)
+	if ok, _ := first.Claim("group/abc", now); !ok {
+		t.Fatal("expected notification to be claimed")
+	}
+
+	// replicas see the same expired claim at once and prune it concurrently
+	expired := now.Add(2 * time.Minute)
+
+	var winners int32
+	var wg sync.WaitGroup
+
+	for idx := 0; idx < 50; idx++ {
+		replica, err := NewFileClaims(dir, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ok, err := replica.Claim("group/abc", expired)
+			if err != nil {
+				t.Error(err)
+			}
+
+			if ok {
+				atomic.AddInt32(&winners, 1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if winners != 1 {
+		t.Errorf("expected exactly one replica to take expired claim, got %d", winners)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+
+	standby, _ := NewSpool(dir)
+	leader, err := NewSpool(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for idx, item := range []string{"first", "second", "third"} {
+		if err := standby.Put([]byte(item), now.Add(time.Duration(idx)*time.Second)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	taken := []string{}
+	err = leader.Take(func(data []byte) error {
+		if string(data) == "third" {
+			return errors.New("shutting down")
+		}
+
+		taken = append(taken, string(data))
+		return nil
+	})
+
+	if err == nil || strings.Join(taken, ",") != "first,second" {
+		t.Fatalf("expected items oldest first until error, got %v %v", taken, err)
+	}
+
+	taken = nil
+	leader.Take(func(data []byte) error {
+		taken = append(taken, string(data))
+		return nil
+	})
+
+	if strings.Join(taken, ",") != "third" {
+		t.Errorf("expected failed item to be taken again, got %v", taken)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected spool to be empty, got %d files", len(files))
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !windows
+// +build !windows
+
+package cluster
+
+import (
+	"os"
+	"syscall"
+)
+
+// FileLock is flock on file, lock is released by OS when process exits
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+func (lock *FileLock) TryLock() (bool, error) {
+	if lock.file != nil {
+		return true, nil
+	}
+
+	file, err := os.OpenFile(lock.path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return false, err
+	}
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	lock.file = file
+
+	return true, nil
+}
+
+// flock waits for exclusive lock of file
+func flock(file *os.File) error {
+	return syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+}
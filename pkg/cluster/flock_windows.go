@@ -0,0 +1,21 @@
+package cluster
+
+import (
+	"errors"
+	"os"
+)
+
+// FileLock is not supported on Windows, TryLock always fails
+type FileLock struct{}
+
+func NewFileLock(path string) *FileLock {
+	return &FileLock{}
+}
+
+func (lock *FileLock) TryLock() (bool, error) {
+	return false, errors.New("file lock is not supported on windows")
+}
+
+func flock(file *os.File) error {
+	return errors.New("file lock is not supported on windows")
+}
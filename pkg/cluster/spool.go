@@ -0,0 +1,69 @@
+package cluster
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Spool passes webhooks accepted by standby replicas to leader through shared directory
+type Spool struct {
+	dir string
+	seq uint64
+}
+
+func NewSpool(dir string) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &Spool{dir: dir}, nil
+}
+
+// Put saves item, item becomes visible to Take only when it is completely written
+func (spool *Spool) Put(data []byte, now time.Time) error {
+	name := fmt.Sprintf("%020d-%d-%d.json", now.UnixNano(), os.Getpid(), atomic.AddUint64(&spool.seq, 1))
+	tmp := filepath.Join(spool.dir, "."+name+".tmp")
+
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(spool.dir, name))
+}
+
+// Take passes items to handle oldest first. Item is removed when handle succeeds,
+// Take stops on handle error and leaves the item for next call
+func (spool *Spool) Take(handle func(data []byte) error) error {
+	files, err := ioutil.ReadDir(spool.dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		path := filepath.Join(spool.dir, file.Name())
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if err := handle(data); err != nil {
+			return err
+		}
+
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
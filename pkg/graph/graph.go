@@ -0,0 +1,199 @@
+package graph
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"time"
+)
+
+// ErrNoData is returned when series have no finite values to draw
+var ErrNoData = errors.New("no data points")
+
+const (
+	padding   = 16
+	gridLines = 4
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	gridColor  = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	axisColor  = color.RGBA{0x80, 0x80, 0x80, 0xff}
+
+	// line colors, series beyond palette are not drawn
+	palette = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xd6, 0x27, 0x28, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+		{0xff, 0x7f, 0x0e, 0xff},
+		{0x94, 0x67, 0xbd, 0xff},
+		{0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff},
+		{0x17, 0xbe, 0xcf, 0xff},
+	}
+)
+
+// MaxSeries is number of series drawn on one chart
+var MaxSeries = len(palette)
+
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+type Series struct {
+	Points []Point
+}
+
+// Bounds are ranges of drawn values
+type Bounds struct {
+	Start, End time.Time
+	Min, Max   float64
+}
+
+// Render draws series as line chart and returns PNG image with drawn value ranges.
+// NaN and infinite values break lines
+func Render(series []Series, width int, height int) ([]byte, Bounds, error) {
+	if len(series) > MaxSeries {
+		series = series[:MaxSeries]
+	}
+
+	bounds, ok := findBounds(series)
+	if !ok {
+		return nil, bounds, ErrNoData
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{background}, image.Point{}, draw.Src)
+
+	left, top, right, bottom := padding, padding, width-padding, height-padding
+
+	for idx := 0; idx <= gridLines; idx++ {
+		y := top + (bottom-top)*idx/gridLines
+		x := left + (right-left)*idx/gridLines
+
+		drawLine(img, left, y, right, y, gridColor, 1)
+		drawLine(img, x, top, x, bottom, gridColor, 1)
+	}
+
+	drawLine(img, left, top, left, bottom, axisColor, 1)
+	drawLine(img, left, bottom, right, bottom, axisColor, 1)
+
+	duration := bounds.End.Sub(bounds.Start).Seconds()
+	span := bounds.Max - bounds.Min
+
+	for idx, s := range series {
+		lineColor := palette[idx%len(palette)]
+		prevX, prevY, hasPrev := 0, 0, false
+
+		for _, point := range s.Points {
+			if math.IsNaN(point.Value) || math.IsInf(point.Value, 0) {
+				hasPrev = false
+				continue
+			}
+
+			x := left
+			if duration > 0 {
+				x += int(float64(right-left) * point.Time.Sub(bounds.Start).Seconds() / duration)
+			}
+
+			y := bottom - int(float64(bottom-top)*(point.Value-bounds.Min)/span)
+
+			if hasPrev {
+				drawLine(img, prevX, prevY, x, y, lineColor, 2)
+			} else {
+				drawLine(img, x, y, x, y, lineColor, 2)
+			}
+
+			prevX, prevY, hasPrev = x, y, true
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := png.Encode(buffer, img); err != nil {
+		return nil, bounds, err
+	}
+
+	return buffer.Bytes(), bounds, nil
+}
+
+// findBounds returns time and value ranges of finite points, flat values get range around them
+func findBounds(series []Series) (Bounds, bool) {
+	bounds := Bounds{Min: math.Inf(1), Max: math.Inf(-1)}
+	found := false
+
+	for _, s := range series {
+		for _, point := range s.Points {
+			if math.IsNaN(point.Value) || math.IsInf(point.Value, 0) {
+				continue
+			}
+
+			if !found || point.Time.Before(bounds.Start) {
+				bounds.Start = point.Time
+			}
+
+			if !found || point.Time.After(bounds.End) {
+				bounds.End = point.Time
+			}
+
+			bounds.Min = math.Min(bounds.Min, point.Value)
+			bounds.Max = math.Max(bounds.Max, point.Value)
+			found = true
+		}
+	}
+
+	if found && bounds.Min == bounds.Max {
+		bounds.Min--
+		bounds.Max++
+	}
+
+	return bounds, found
+}
+
+// drawLine draws line with Bresenham's algorithm, width is size of square brush
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA, width int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+
+	for {
+		for bx := 0; bx < width; bx++ {
+			for by := 0; by < width; by++ {
+				img.SetRGBA(x0+bx, y0+by, c)
+			}
+		}
+
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
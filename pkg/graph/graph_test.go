@@ -0,0 +1,56 @@
+package graph
+
+import (
+	"bytes"
+	"image/png"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRender(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	series := []Series{
+		{Points: []Point{{start, 1}, {start.Add(time.Minute), math.NaN()}, {start.Add(2 * time.Minute), 5}}},
+		{Points: []Point{{start.Add(time.Minute), -1}}},
+	}
+
+	data, bounds, err := Render(series, 300, 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bounds.Start.Equal(start) || !bounds.End.Equal(start.Add(2*time.Minute)) || bounds.Min != -1 || bounds.Max != 5 {
+		t.Errorf("unexpected bounds %+v", bounds)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if size := img.Bounds().Size(); size.X != 300 || size.Y != 120 {
+		t.Errorf("unexpected image size %v", size)
+	}
+}
+
+func TestRenderFlat(t *testing.T) {
+	start := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	_, bounds, err := Render([]Series{{Points: []Point{{start, 2}}}}, 200, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if bounds.Min != 1 || bounds.Max != 3 {
+		t.Errorf("expected range around flat value, got %v..%v", bounds.Min, bounds.Max)
+	}
+}
+
+func TestRenderNoData(t *testing.T) {
+	_, _, err := Render([]Series{{Points: []Point{{time.Now(), math.Inf(1)}}}}, 200, 100)
+	if err != ErrNoData {
+		t.Errorf("expected ErrNoData, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package matcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type MatchType string
+
+// Match types follow Alertmanager matchers syntax
+const (
+	Equal     MatchType = "="
+	NotEqual  MatchType = "!="
+	Regexp    MatchType = "=~"
+	NotRegexp MatchType = "!~"
+)
+
+// Matcher matches one alert label, missing labels are matched as empty value
+type Matcher struct {
+	Name  string
+	Type  MatchType
+	Value string
+
+	re *regexp.Regexp
+}
+
+// Parse parses matcher like `alertname=X`, `instance=~db.*`, `env!=dev` or `job!~node.*`,
+// value can be double quoted
+func Parse(s string) (*Matcher, error) {
+	s = strings.TrimSpace(s)
+
+	idx := strings.IndexAny(s, "=!")
+	if idx <= 0 {
+		return nil, fmt.Errorf("invalid matcher %q, expected label=value", s)
+	}
+
+	m := &Matcher{Name: s[:idx]}
+	rest := s[idx:]
+
+	for _, matchType := range []MatchType{Regexp, NotRegexp, NotEqual, Equal} {
+		if strings.HasPrefix(rest, string(matchType)) {
+			m.Type = matchType
+			m.Value = strings.TrimPrefix(rest, string(matchType))
+			break
+		}
+	}
+
+	if m.Type == "" {
+		return nil, fmt.Errorf("invalid matcher %q, expected label=value", s)
+	}
+
+	if len(m.Value) >= 2 && strings.HasPrefix(m.Value, `"`) && strings.HasSuffix(m.Value, `"`) {
+		m.Value = m.Value[1 : len(m.Value)-1]
+	}
+
+	if m.Type == Regexp || m.Type == NotRegexp {
+		re, err := regexp.Compile("^(?:" + m.Value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %q: %v", s, err)
+		}
+
+		m.re = re
+	}
+
+	return m, nil
+}
+
+func (m *Matcher) Matches(value string) bool {
+	switch m.Type {
+	case Equal:
+		return value == m.Value
+	case NotEqual:
+		return value != m.Value
+	case Regexp:
+		return m.re.MatchString(value)
+	case NotRegexp:
+		return !m.re.MatchString(value)
+	}
+
+	return false
+}
+
+// IsRegex reports whether matcher value is regular expression
+func (m *Matcher) IsRegex() bool {
+	return m.Type == Regexp || m.Type == NotRegexp
+}
+
+// IsNegative reports whether matcher excludes matched values
+func (m *Matcher) IsNegative() bool {
+	return m.Type == NotEqual || m.Type == NotRegexp
+}
+
+func (m *Matcher) String() string {
+	return m.Name + string(m.Type) + m.Value
+}
+
+// Matchers match alert when all of them match, empty list matches everything
+type Matchers []*Matcher
+
+// ParseAll parses list of matchers
+func ParseAll(list []string) (Matchers, error) {
+	matchers := make(Matchers, 0, len(list))
+
+	for _, s := range list {
+		m, err := Parse(s)
+		if err != nil {
+			return nil, err
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	return matchers, nil
+}
+
+func (ms Matchers) Match(labels map[string]string) bool {
+	for _, m := range ms {
+		if !m.Matches(labels[m.Name]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (ms Matchers) String() string {
+	parts := make([]string, 0, len(ms))
+	for _, m := range ms {
+		parts = append(parts, m.String())
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// UnmarshalJSON reads matchers from list of strings like ["severity=critical", "team=~db.*"]
+func (ms *Matchers) UnmarshalJSON(data []byte) error {
+	list := make([]string, 0)
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	parsed, err := ParseAll(list)
+	if err != nil {
+		return err
+	}
+
+	*ms = parsed
+
+	return nil
+}
+
+func (ms Matchers) MarshalJSON() ([]byte, error) {
+	list := make([]string, 0, len(ms))
+	for _, m := range ms {
+		list = append(list, m.String())
+	}
+
+	return json.Marshal(list)
+}
@@ -0,0 +1,60 @@
+package matcher
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	labels := map[string]string{"alertname": "DiskFull", "instance": "db-01:9100", "env": "prod"}
+
+	cases := []struct {
+		matchers []string
+		match    bool
+	}{
+		{[]string{"alertname=DiskFull"}, true},
+		{[]string{`alertname="DiskFull"`}, true},
+		{[]string{"alertname=DiskFull", "instance=~db.*"}, true},
+		{[]string{"instance=~db"}, false},
+		{[]string{"env!=prod"}, false},
+		{[]string{"env!~dev|stage"}, true},
+		{[]string{"team="}, true},
+		{[]string{"team=payments"}, false},
+		{[]string{}, true},
+	}
+
+	for _, tc := range cases {
+		matchers, err := ParseAll(tc.matchers)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if match := matchers.Match(labels); match != tc.match {
+			t.Errorf("%v: expected %v, got %v", tc.matchers, tc.match, match)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{"alertname", "=value", "instance=~(db", "name!value"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	matchers := Matchers{}
+	if err := json.Unmarshal([]byte(`["severity=critical", "team=~db.*"]`), &matchers); err != nil {
+		t.Fatal(err)
+	}
+
+	if matchers.String() != "severity=critical team=~db.*" {
+		t.Errorf("unexpected matchers %v", matchers)
+	}
+
+	data, _ := json.Marshal(matchers)
+	if string(data) != `["severity=critical","team=~db.*"]` {
+		t.Errorf("unexpected json %s", data)
+	}
+}
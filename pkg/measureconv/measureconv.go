@@ -215,7 +215,8 @@ func (c *Converter) FormatFloat(f string) string {
 	return strconv.FormatFloat(v, 'f', -1, 64)
 }
 
-func (c *Converter) FormatDate(toformat string) string {
+// FormatDate принимает time.Time или строку в RFC3339
+func (c *Converter) FormatDate(toformat interface{}) string {
 
 	// Error handling
 	if c.Config.TimeZone == "" {
@@ -228,10 +229,20 @@ func (c *Converter) FormatDate(toformat string) string {
 		panic(nil)
 	}
 
-	t, err := time.Parse(time.RFC3339Nano, toformat)
+	var t time.Time
 
-	if err != nil {
-		fmt.Println(err)
+	switch value := toformat.(type) {
+	case time.Time:
+		t = value
+	case string:
+		parsed, err := time.Parse(time.RFC3339Nano, value)
+		if err != nil {
+			fmt.Println(err)
+		}
+
+		t = parsed
+	default:
+		fmt.Printf("FormatDate: unsupported value %v\n", toformat)
 	}
 
 	loc, _ := time.LoadLocation(c.Config.TimeZone)
@@ -0,0 +1,127 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 10 * time.Second
+
+// Client calls Prometheus HTTP API v1
+type Client struct {
+	URL  string
+	HTTP *http.Client
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		URL:  strings.TrimSuffix(baseURL, "/"),
+		HTTP: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Series is one time series of range query result
+type Series struct {
+	Metric  map[string]string
+	Samples []Sample
+}
+
+type queryRangeResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][2]interface{}  `json:"values"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// QueryRange evaluates expression over time range, GET /api/v1/query_range
+func (c *Client) QueryRange(expr string, start time.Time, end time.Time, step time.Duration) ([]Series, error) {
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(end.Unix(), 10))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	resp, err := c.HTTP.Get(c.URL + "/api/v1/query_range?" + params.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	result := queryRangeResponse{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		if resp.StatusCode/100 != 2 {
+			return nil, fmt.Errorf("prometheus query_range: %v", resp.Status)
+		}
+
+		return nil, err
+	}
+
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query_range: %v %v", result.ErrorType, result.Error)
+	}
+
+	if result.Data.ResultType != "matrix" {
+		return nil, fmt.Errorf("prometheus query_range: unexpected result type %q", result.Data.ResultType)
+	}
+
+	series := make([]Series, 0, len(result.Data.Result))
+
+	for _, item := range result.Data.Result {
+		samples := make([]Sample, 0, len(item.Values))
+
+		for _, value := range item.Values {
+			timestamp, ok := value[0].(float64)
+			text, textOk := value[1].(string)
+			if !ok || !textOk {
+				return nil, fmt.Errorf("prometheus query_range: invalid sample %v", value)
+			}
+
+			parsed, err := strconv.ParseFloat(text, 64)
+			if err != nil {
+				return nil, fmt.Errorf("prometheus query_range: invalid sample value %q", text)
+			}
+
+			seconds := int64(timestamp)
+			nanos := int64((timestamp - float64(seconds)) * float64(time.Second))
+			samples = append(samples, Sample{Time: time.Unix(seconds, nanos), Value: parsed})
+		}
+
+		series = append(series, Series{Metric: item.Metric, Samples: samples})
+	}
+
+	return series, nil
+}
+
+// ExprFromGeneratorURL extracts alert expression from generatorURL of Prometheus alert,
+// like http://prometheus:9090/graph?g0.expr=up+%3D%3D+0&g0.tab=1. Returns empty string
+// when URL has no expression
+func ExprFromGeneratorURL(generatorURL string) string {
+	parsed, err := url.Parse(generatorURL)
+	if err != nil {
+		return ""
+	}
+
+	return parsed.Query().Get("g0.expr")
+}
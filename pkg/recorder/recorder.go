@@ -0,0 +1,90 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Record is a single incoming webhook saved as one line of JSONL file
+type Record struct {
+	Time time.Time `json:"time"`
+	// name of bot which received webhook, empty for main bot
+	Bot string `json:"bot,omitempty"`
+	// request path, webhooks without chat ids in path are routed by subscriptions
+	Path    string          `json:"path,omitempty"`
+	ChatIDs []int64         `json:"chat_ids"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+func NewRecord(bot string, path string, chatIDs []int64, payload []byte) Record {
+	return Record{Time: time.Now(), Bot: bot, Path: path, ChatIDs: chatIDs, Payload: json.RawMessage(payload)}
+}
+
+// Recorder appends records to JSONL file, safe for concurrent use
+type Recorder struct {
+	path string
+	mu   sync.Mutex
+}
+
+func New(path string) *Recorder {
+	return &Recorder{path: path}
+}
+
+// Append writes record to the end of file, file is created if not exists
+func (r *Recorder) Append(record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	file, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// ReadFile reads all records from JSONL file, empty lines are skipped
+func ReadFile(path string) ([]Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]Record, 0)
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		record := Record{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%v:%d: %v", path, line, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
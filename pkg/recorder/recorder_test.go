@@ -0,0 +1,50 @@
+package recorder
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAppendAndReadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorded.jsonl")
+	r := New(path)
+
+	first := Record{Time: time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC), ChatIDs: []int64{1, -100500}, Payload: []byte(`{"status":"firing"}`)}
+	second := NewRecord("partner", "/alert/partner", nil, []byte(`{"status":"resolved"}`))
+
+	for _, record := range []Record{first, second} {
+		if err := r.Append(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	records, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+
+	if !records[0].Time.Equal(first.Time) || len(records[0].ChatIDs) != 2 || records[0].ChatIDs[1] != -100500 || string(records[0].Payload) != `{"status":"firing"}` {
+		t.Errorf("unexpected first record %+v", records[0])
+	}
+
+	if !records[1].Time.Equal(second.Time) || records[1].Bot != "partner" || records[1].Path != "/alert/partner" || len(records[1].ChatIDs) != 0 || string(records[1].Payload) != `{"status":"resolved"}` {
+		t.Errorf("unexpected second record %+v", records[1])
+	}
+}
+
+func TestReadFileErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recorded.jsonl")
+	if err := ioutil.WriteFile(path, []byte("{\"chat_ids\":[1],\"payload\":{}}\n\n{broken\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := ReadFile(path); err == nil || err.Error() != path+":3: invalid character 'b' looking for beginning of object key string" {
+		t.Errorf("expected error with line number, got %v", err)
+	}
+}
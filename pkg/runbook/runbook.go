@@ -0,0 +1,171 @@
+package runbook
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const requestTimeout = 10 * time.Second
+
+// ErrNoSource is returned for runbook URLs not matching any source prefix
+var ErrNoSource = errors.New("no runbook source for URL")
+
+// Source maps runbook URLs with prefix to local directory or HTTP base URL with
+// markdown files. Runbook path without extension gets .md
+type Source struct {
+	Prefix string `json:"prefix"`
+	Path   string `json:"path"`
+	URL    string `json:"url"`
+}
+
+type cacheEntry struct {
+	fetchedAt time.Time
+	markdown  string
+	err       error
+}
+
+// Fetcher reads runbooks and caches them, failed reads are cached too
+type Fetcher struct {
+	Sources []Source
+	TTL     time.Duration
+	HTTP    *http.Client
+
+	mu    sync.Mutex
+	cache map[string]cacheEntry
+}
+
+func New(sources []Source, ttl time.Duration) *Fetcher {
+	return &Fetcher{
+		Sources: sources,
+		TTL:     ttl,
+		HTTP:    &http.Client{Timeout: requestTimeout},
+		cache:   make(map[string]cacheEntry),
+	}
+}
+
+// Fetch returns markdown of runbook, URL fragment is ignored
+func (f *Fetcher) Fetch(runbookURL string, now time.Time) (string, error) {
+	runbookURL = strings.SplitN(runbookURL, "#", 2)[0]
+
+	f.mu.Lock()
+	entry, ok := f.cache[runbookURL]
+	f.mu.Unlock()
+
+	if ok && now.Sub(entry.fetchedAt) < f.TTL {
+		return entry.markdown, entry.err
+	}
+
+	markdown, err := f.read(runbookURL)
+
+	f.mu.Lock()
+	f.cache[runbookURL] = cacheEntry{fetchedAt: now, markdown: markdown, err: err}
+	f.mu.Unlock()
+
+	return markdown, err
+}
+
+func (f *Fetcher) read(runbookURL string) (string, error) {
+	for _, source := range f.Sources {
+		if !strings.HasPrefix(runbookURL, source.Prefix) {
+			continue
+		}
+
+		name := strings.SplitN(strings.TrimPrefix(runbookURL, source.Prefix), "?", 2)[0]
+		if path.Ext(name) == "" {
+			name += ".md"
+		}
+
+		if source.Path != "" {
+			return readFile(source.Path, name)
+		}
+
+		return f.get(strings.TrimSuffix(source.URL, "/") + "/" + strings.TrimPrefix(name, "/"))
+	}
+
+	return "", ErrNoSource
+}
+
+// readFile reads file from directory, name is cleaned as absolute path so ".." can't
+// leave directory
+func readFile(dir string, name string) (string, error) {
+	cleaned := path.Clean("/" + name)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(cleaned)))
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+func (f *Fetcher) get(url string) (string, error) {
+	resp, err := f.HTTP.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("runbook %v: %v", url, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+var headingRe = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+
+// Section returns text of markdown section with heading name (case insensitive), empty name
+// means the first section. Nested sections are included, text is cut to maxLength
+// characters on line boundary
+func Section(markdown string, name string, maxLength int) string {
+	lines := strings.Split(strings.Replace(markdown, "\r\n", "\n", -1), "\n")
+
+	level := 0
+	found := make([]string, 0)
+
+	for _, line := range lines {
+		match := headingRe.FindStringSubmatch(line)
+
+		if level > 0 {
+			if match != nil && len(match[1]) <= level {
+				break
+			}
+
+			found = append(found, line)
+			continue
+		}
+
+		if match != nil && (name == "" || strings.EqualFold(match[2], name)) {
+			level = len(match[1])
+		}
+	}
+
+	return truncate(strings.TrimSpace(strings.Join(found, "\n")), maxLength)
+}
+
+func truncate(text string, maxLength int) string {
+	runes := []rune(text)
+	if maxLength <= 0 || len(runes) <= maxLength {
+		return text
+	}
+
+	cut := string(runes[:maxLength])
+	if idx := strings.LastIndex(cut, "\n"); idx > 0 {
+		cut = cut[:idx]
+	}
+
+	return strings.TrimSpace(cut) + "\n…"
+}
@@ -0,0 +1,115 @@
+package runbook
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const diskFull = `# Disk full
+
+Disk usage is above 90%.
+
+## First steps
+
+1. Check largest directories with ` + "`du -sh /*`" + `
+2. Rotate logs
+
+### Logs
+
+Logs are in /var/log.
+
+## Escalation
+
+Call storage team.
+`
+
+func TestSection(t *testing.T) {
+	cases := []struct {
+		name      string
+		maxLength int
+		expected  string
+	}{
+		{"first steps", 0, "1. Check largest directories with `du -sh /*`\n2. Rotate logs\n\n### Logs\n\nLogs are in /var/log."},
+		{"", 0, "Disk usage is above 90%.\n\n## First steps\n\n1. Check largest directories with `du -sh /*`\n2. Rotate logs\n\n### Logs\n\nLogs are in /var/log.\n\n## Escalation\n\nCall storage team."},
+		{"First steps", 60, "1. Check largest directories with `du -sh /*`\n…"},
+		{"Missing", 0, ""},
+	}
+
+	for _, tc := range cases {
+		if actual := Section(diskFull, tc.name, tc.maxLength); actual != tc.expected {
+			t.Errorf("Section(%q, %d) = %q, expected %q", tc.name, tc.maxLength, actual, tc.expected)
+		}
+	}
+}
+
+func TestFetchPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "disk-full.md"), []byte(diskFull), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := New([]Source{{Prefix: "https://wiki.example.com/runbooks/", Path: dir}}, time.Minute)
+	now := time.Now()
+
+	markdown, err := fetcher.Fetch("https://wiki.example.com/runbooks/disk-full#first-steps", now)
+	if err != nil || markdown != diskFull {
+		t.Fatalf("unexpected runbook %q, %v", markdown, err)
+	}
+
+	// cached runbook is returned after file is removed
+	os.Remove(filepath.Join(dir, "disk-full.md"))
+
+	if _, err := fetcher.Fetch("https://wiki.example.com/runbooks/disk-full", now.Add(30*time.Second)); err != nil {
+		t.Errorf("expected cached runbook, got %v", err)
+	}
+
+	if _, err := fetcher.Fetch("https://wiki.example.com/runbooks/disk-full", now.Add(2*time.Minute)); err == nil {
+		t.Errorf("expected error after cache expired")
+	}
+
+	if _, err := fetcher.Fetch("https://wiki.example.com/runbooks/../../etc/passwd", now); err == nil {
+		t.Errorf("expected path outside of directory to fail")
+	}
+
+	if _, err := fetcher.Fetch("https://other.example.com/disk-full", now); err != ErrNoSource {
+		t.Errorf("expected ErrNoSource, got %v", err)
+	}
+}
+
+func TestFetchURL(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		if r.URL.Path != "/runbooks/disk-full.md" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprint(w, diskFull)
+	}))
+	defer server.Close()
+
+	fetcher := New([]Source{{Prefix: "https://wiki.example.com/", URL: server.URL + "/runbooks/"}}, time.Minute)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if markdown, err := fetcher.Fetch("https://wiki.example.com/disk-full", now); err != nil || markdown != diskFull {
+			t.Fatalf("unexpected runbook %q, %v", markdown, err)
+		}
+	}
+
+	if _, err := fetcher.Fetch("https://wiki.example.com/missing", now); err == nil {
+		t.Errorf("expected error for missing runbook")
+	}
+
+	if requests != 2 {
+		t.Errorf("expected runbook to be cached, got %d requests", requests)
+	}
+}
@@ -0,0 +1,196 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Actions applied to non urgent alerts outside of schedule hours
+const (
+	ActionSilent = "silent" // send without notification sound
+	ActionHold   = "hold"   // keep and deliver when hours start again
+	ActionDrop   = "drop"   // do not send at all
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule describes hours when chat wants to be notified, time outside
+// of these hours is quiet
+type Schedule struct {
+	Location    *time.Location
+	Hours       []Range
+	QuietAction string
+	MinSeverity string
+}
+
+// Range is a time range on selected weekdays, From greater than To means
+// range crosses midnight and ends on the next day
+type Range struct {
+	Days [7]bool
+	From int // minutes since midnight
+	To   int
+}
+
+// config is representation of schedule in config file:
+//
+//	schedule:
+//	  time_zone: Europe/Moscow
+//	  hours:
+//	    - days: mon-fri
+//	      from: "09:00"
+//	      to: "21:00"
+//	  quiet_action: hold
+//	  min_severity: critical
+type config struct {
+	TimeZone    string `json:"time_zone"`
+	QuietAction string `json:"quiet_action"`
+	MinSeverity string `json:"min_severity"`
+	Hours       []struct {
+		Days string `json:"days"`
+		From string `json:"from"`
+		To   string `json:"to"`
+	} `json:"hours"`
+}
+
+func (s *Schedule) UnmarshalJSON(data []byte) error {
+	raw := config{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	location, err := time.LoadLocation(raw.TimeZone)
+	if err != nil {
+		return fmt.Errorf("schedule: %v", err)
+	}
+
+	s.Location = location
+	s.MinSeverity = raw.MinSeverity
+
+	switch raw.QuietAction {
+	case "":
+		s.QuietAction = ActionSilent
+	case ActionSilent, ActionHold, ActionDrop:
+		s.QuietAction = raw.QuietAction
+	default:
+		return fmt.Errorf("schedule: unknown quiet_action %q, expected silent, hold or drop", raw.QuietAction)
+	}
+
+	s.Hours = make([]Range, 0, len(raw.Hours))
+
+	for _, hours := range raw.Hours {
+		r := Range{}
+
+		if r.Days, err = parseDays(hours.Days); err != nil {
+			return err
+		}
+
+		if r.From, err = parseClock(hours.From); err != nil {
+			return err
+		}
+
+		if r.To, err = parseClock(hours.To); err != nil {
+			return err
+		}
+
+		s.Hours = append(s.Hours, r)
+	}
+
+	return nil
+}
+
+// Active reports whether t is inside of schedule hours
+func (s *Schedule) Active(t time.Time) bool {
+	local := t.In(s.Location)
+	minute := local.Hour()*60 + local.Minute()
+	today := local.Weekday()
+	yesterday := (today + 6) % 7
+
+	for _, r := range s.Hours {
+		switch {
+		case r.From == r.To:
+			if r.Days[today] {
+				return true
+			}
+		case r.From < r.To:
+			if r.Days[today] && minute >= r.From && minute < r.To {
+				return true
+			}
+		default:
+			if (r.Days[today] && minute >= r.From) || (r.Days[yesterday] && minute < r.To) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// parseDays parses "mon-fri", "sat,sun" or "mon,wed-fri", empty string means every day
+func parseDays(s string) (days [7]bool, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	if s == "" {
+		for i := range days {
+			days[i] = true
+		}
+
+		return
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		bounds := strings.SplitN(strings.TrimSpace(part), "-", 2)
+
+		from, ok := weekdays[bounds[0]]
+		if !ok {
+			return days, fmt.Errorf("schedule: unknown weekday %q", bounds[0])
+		}
+
+		to := from
+		if len(bounds) == 2 {
+			if to, ok = weekdays[bounds[1]]; !ok {
+				return days, fmt.Errorf("schedule: unknown weekday %q", bounds[1])
+			}
+		}
+
+		for day := from; ; day = (day + 1) % 7 {
+			days[day] = true
+
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return
+}
+
+// parseClock parses "HH:MM" to minutes since midnight, "24:00" is the end of day
+func parseClock(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("schedule: invalid time %q, expected HH:MM", s)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("schedule: invalid time %q, expected HH:MM", s)
+	}
+
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("schedule: invalid time %q, expected HH:MM", s)
+	}
+
+	return hours*60 + minutes, nil
+}
@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func parse(t *testing.T, raw string) *Schedule {
+	s := new(Schedule)
+	if err := json.Unmarshal([]byte(raw), s); err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func TestActive(t *testing.T) {
+	s := parse(t, `{
+		"time_zone": "Europe/Moscow",
+		"hours": [
+			{"days": "mon-fri", "from": "09:00", "to": "21:00"},
+			{"days": "sat", "from": "22:00", "to": "02:00"}
+		]
+	}`)
+
+	cases := []struct {
+		time   string
+		active bool
+	}{
+		{"2026-10-19T09:00:00+03:00", true},  // monday morning
+		{"2026-10-19T08:59:00+03:00", false}, // before hours
+		{"2026-10-19T21:00:00+03:00", false}, // end is exclusive
+		{"2026-10-19T06:30:00Z", true},       // 09:30 in Moscow
+		{"2026-10-24T12:00:00+03:00", false}, // saturday day
+		{"2026-10-24T23:00:00+03:00", true},  // saturday night
+		{"2026-10-25T01:59:00+03:00", true},  // sunday, saturday range crosses midnight
+		{"2026-10-25T02:00:00+03:00", false},
+		{"2026-10-25T23:00:00+03:00", false}, // sunday night
+	}
+
+	for _, tc := range cases {
+		at, _ := time.Parse(time.RFC3339, tc.time)
+
+		if active := s.Active(at); active != tc.active {
+			t.Errorf("%v: expected active=%v, got %v", tc.time, tc.active, active)
+		}
+	}
+
+	if s.QuietAction != ActionSilent {
+		t.Errorf("expected default quiet action silent, got %q", s.QuietAction)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	invalid := []string{
+		`{"time_zone": "Mars/Olympus"}`,
+		`{"quiet_action": "mute"}`,
+		`{"hours": [{"days": "monday", "from": "09:00", "to": "10:00"}]}`,
+		`{"hours": [{"from": "9", "to": "10:00"}]}`,
+		`{"hours": [{"from": "09:00", "to": "25:00"}]}`,
+	}
+
+	for _, raw := range invalid {
+		if err := json.Unmarshal([]byte(raw), new(Schedule)); err == nil {
+			t.Errorf("expected error for %v", raw)
+		}
+	}
+}
+
+func TestParseDays(t *testing.T) {
+	days, err := parseDays("fri-mon, wed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [7]bool{true, true, false, true, false, true, true}
+	if days != expected {
+		t.Errorf("expected %v, got %v", expected, days)
+	}
+}
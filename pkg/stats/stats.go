@@ -0,0 +1,213 @@
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recent Telegram errors kept for /status
+const errorsLimit = 10
+
+type ChatStats struct {
+	ChatID     int64
+	Sent       int64
+	Failed     int64
+	LastSentAt time.Time
+}
+
+type ReceiverStats struct {
+	Receiver       string
+	Webhooks       int64
+	LastReceivedAt time.Time
+}
+
+type TelegramError struct {
+	Time   time.Time
+	ChatID int64
+	Error  string
+}
+
+// Snapshot is a copy of counters, chats and receivers are sorted
+type Snapshot struct {
+	StartedAt        time.Time
+	ConfigLoadedAt   time.Time
+	WebhooksAccepted int64
+	WebhooksRejected int64
+	Pending          int64
+	Receivers        []ReceiverStats
+	Chats            []ChatStats
+	Errors           []TelegramError
+}
+
+// Stats counts webhooks and deliveries, safe for concurrent use
+type Stats struct {
+	mu sync.Mutex
+
+	startedAt        time.Time
+	configLoadedAt   time.Time
+	webhooksRejected int64
+	pending          int64
+	receivers        map[string]*ReceiverStats
+	chats            map[int64]*ChatStats
+	errors           []TelegramError
+}
+
+func New(now time.Time) *Stats {
+	return &Stats{
+		startedAt:      now,
+		configLoadedAt: now,
+		receivers:      make(map[string]*ReceiverStats),
+		chats:          make(map[int64]*ChatStats),
+	}
+}
+
+func (s *Stats) ConfigLoaded(t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.configLoadedAt = t
+}
+
+func (s *Stats) WebhookAccepted(receiver string, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats, ok := s.receivers[receiver]
+	if !ok {
+		stats = &ReceiverStats{Receiver: receiver}
+		s.receivers[receiver] = stats
+	}
+
+	stats.Webhooks++
+	stats.LastReceivedAt = t
+}
+
+func (s *Stats) WebhookRejected() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhooksRejected++
+}
+
+// AddPending changes count of deliveries waiting to be sent
+func (s *Stats) AddPending(delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending += delta
+}
+
+func (s *Stats) chat(chatID int64) *ChatStats {
+	stats, ok := s.chats[chatID]
+	if !ok {
+		stats = &ChatStats{ChatID: chatID}
+		s.chats[chatID] = stats
+	}
+
+	return stats
+}
+
+func (s *Stats) MessageSent(chatID int64, t time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := s.chat(chatID)
+	stats.Sent++
+	stats.LastSentAt = t
+}
+
+func (s *Stats) MessageFailed(chatID int64, t time.Time, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.chat(chatID).Failed++
+
+	s.errors = append(s.errors, TelegramError{Time: t, ChatID: chatID, Error: err.Error()})
+	if len(s.errors) > errorsLimit {
+		s.errors = s.errors[len(s.errors)-errorsLimit:]
+	}
+}
+
+func (s *Stats) Snapshot() Snapshot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := Snapshot{
+		StartedAt:        s.startedAt,
+		ConfigLoadedAt:   s.configLoadedAt,
+		WebhooksRejected: s.webhooksRejected,
+		Pending:          s.pending,
+		Receivers:        make([]ReceiverStats, 0, len(s.receivers)),
+		Chats:            make([]ChatStats, 0, len(s.chats)),
+		Errors:           append([]TelegramError(nil), s.errors...),
+	}
+
+	for _, receiver := range s.receivers {
+		snapshot.WebhooksAccepted += receiver.Webhooks
+		snapshot.Receivers = append(snapshot.Receivers, *receiver)
+	}
+
+	for _, chat := range s.chats {
+		snapshot.Chats = append(snapshot.Chats, *chat)
+	}
+
+	sort.Slice(snapshot.Receivers, func(i, j int) bool { return snapshot.Receivers[i].Receiver < snapshot.Receivers[j].Receiver })
+	sort.Slice(snapshot.Chats, func(i, j int) bool { return snapshot.Chats[i].ChatID < snapshot.Chats[j].ChatID })
+
+	return snapshot
+}
+
+// WriteMetrics writes counters in Prometheus text exposition format
+func (s *Stats) WriteMetrics(w io.Writer, version string) error {
+	snapshot := s.Snapshot()
+
+	metrics := []struct {
+		name   string
+		help   string
+		kind   string
+		values []string
+	}{
+		{"tbot_build_info", "Bot version.", "gauge", []string{fmt.Sprintf("{version=%q} 1", version)}},
+		{"tbot_start_time_seconds", "Bot start time.", "gauge", []string{fmt.Sprintf(" %d", snapshot.StartedAt.Unix())}},
+		{"tbot_config_load_time_seconds", "Config load time.", "gauge", []string{fmt.Sprintf(" %d", snapshot.ConfigLoadedAt.Unix())}},
+		{"tbot_webhooks_rejected_total", "Webhooks rejected because of invalid chats or payload.", "counter", []string{fmt.Sprintf(" %d", snapshot.WebhooksRejected)}},
+		{"tbot_pending_deliveries", "Alert deliveries waiting to be sent.", "gauge", []string{fmt.Sprintf(" %d", snapshot.Pending)}},
+		{"tbot_webhooks_total", "Accepted webhooks by receiver.", "counter", nil},
+		{"tbot_last_webhook_time_seconds", "Time of the last accepted webhook by receiver.", "gauge", nil},
+		{"tbot_messages_sent_total", "Alert messages sent to Telegram by chat.", "counter", nil},
+		{"tbot_messages_failed_total", "Alert messages failed to send to Telegram by chat.", "counter", nil},
+	}
+
+	for _, receiver := range snapshot.Receivers {
+		labels := fmt.Sprintf("{receiver=%q}", receiver.Receiver)
+		metrics[5].values = append(metrics[5].values, fmt.Sprintf("%v %d", labels, receiver.Webhooks))
+		metrics[6].values = append(metrics[6].values, fmt.Sprintf("%v %d", labels, receiver.LastReceivedAt.Unix()))
+	}
+
+	for _, chat := range snapshot.Chats {
+		labels := fmt.Sprintf("{chat_id=\"%d\"}", chat.ChatID)
+		metrics[7].values = append(metrics[7].values, fmt.Sprintf("%v %d", labels, chat.Sent))
+		metrics[8].values = append(metrics[8].values, fmt.Sprintf("%v %d", labels, chat.Failed))
+	}
+
+	for _, metric := range metrics {
+		if len(metric.values) == 0 {
+			continue
+		}
+
+		if _, err := fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", metric.name, metric.help, metric.name, metric.kind); err != nil {
+			return err
+		}
+
+		for _, value := range metric.values {
+			if _, err := fmt.Fprintf(w, "%v%v\n", metric.name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
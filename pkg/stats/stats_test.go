@@ -0,0 +1,84 @@
+package stats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestErrorsLimit(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stats := New(now)
+
+	for i := 0; i < errorsLimit+5; i++ {
+		stats.MessageFailed(1, now, fmt.Errorf("error %d", i))
+	}
+
+	snapshot := stats.Snapshot()
+
+	if len(snapshot.Errors) != errorsLimit {
+		t.Fatalf("expected %d errors, got %d", errorsLimit, len(snapshot.Errors))
+	}
+
+	if snapshot.Errors[0].Error != "error 5" {
+		t.Errorf("expected oldest errors to be dropped, got %q", snapshot.Errors[0].Error)
+	}
+
+	if snapshot.Chats[0].Failed != errorsLimit+5 {
+		t.Errorf("expected all failures counted, got %d", snapshot.Chats[0].Failed)
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stats := New(now)
+
+	stats.WebhookAccepted("team", now.Add(time.Minute))
+	stats.WebhookAccepted("admins", now)
+	stats.WebhookAccepted("team", now.Add(2*time.Minute))
+	stats.AddPending(2)
+	stats.MessageSent(-10, now)
+	stats.MessageFailed(-10, now, errors.New("Forbidden"))
+
+	buffer := new(bytes.Buffer)
+	if err := stats.WriteMetrics(buffer, "v1.0"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `# HELP tbot_build_info Bot version.
+# TYPE tbot_build_info gauge
+tbot_build_info{version="v1.0"} 1
+# HELP tbot_start_time_seconds Bot start time.
+# TYPE tbot_start_time_seconds gauge
+tbot_start_time_seconds 1000
+# HELP tbot_config_load_time_seconds Config load time.
+# TYPE tbot_config_load_time_seconds gauge
+tbot_config_load_time_seconds 1000
+# HELP tbot_webhooks_rejected_total Webhooks rejected because of invalid chats or payload.
+# TYPE tbot_webhooks_rejected_total counter
+tbot_webhooks_rejected_total 0
+# HELP tbot_pending_deliveries Alert deliveries waiting to be sent.
+# TYPE tbot_pending_deliveries gauge
+tbot_pending_deliveries 2
+# HELP tbot_webhooks_total Accepted webhooks by receiver.
+# TYPE tbot_webhooks_total counter
+tbot_webhooks_total{receiver="admins"} 1
+tbot_webhooks_total{receiver="team"} 2
+# HELP tbot_last_webhook_time_seconds Time of the last accepted webhook by receiver.
+# TYPE tbot_last_webhook_time_seconds gauge
+tbot_last_webhook_time_seconds{receiver="admins"} 1000
+tbot_last_webhook_time_seconds{receiver="team"} 1120
+# HELP tbot_messages_sent_total Alert messages sent to Telegram by chat.
+# TYPE tbot_messages_sent_total counter
+tbot_messages_sent_total{chat_id="-10"} 1
+# HELP tbot_messages_failed_total Alert messages failed to send to Telegram by chat.
+# TYPE tbot_messages_failed_total counter
+tbot_messages_failed_total{chat_id="-10"} 1
+`
+
+	if buffer.String() != expected {
+		t.Errorf("unexpected metrics:\n%v", buffer.String())
+	}
+}
@@ -0,0 +1,95 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var acksBucket = []byte("acks")
+
+// Ack marks firing alert as taken by user, kept until alert is resolved
+type Ack struct {
+	Fingerprint string    `json:"fingerprint"`
+	AlertName   string    `json:"alertname"`
+	ChatID      int64     `json:"chatId"`
+	MessageID   int       `json:"messageId"`
+	AckedBy     string    `json:"ackedBy"`
+	AckedAt     time.Time `json:"ackedAt"`
+}
+
+// Acks returns acknowledged alerts by fingerprint
+func (s *Store) Acks() (map[string]Ack, error) {
+	result := make(map[string]Ack)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(acksBucket).ForEach(func(key, value []byte) error {
+			ack := Ack{}
+			if err := json.Unmarshal(value, &ack); err != nil {
+				return err
+			}
+
+			result[string(key)] = ack
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+// PutAcks saves acks, existing acks of the same alerts are kept
+func (s *Store) PutAcks(acks []Ack) ([]Ack, error) {
+	added := make([]Ack, 0, len(acks))
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(acksBucket)
+
+		for _, ack := range acks {
+			if bucket.Get([]byte(ack.Fingerprint)) != nil {
+				continue
+			}
+
+			if err := put(bucket, []byte(ack.Fingerprint), ack); err != nil {
+				return err
+			}
+
+			added = append(added, ack)
+		}
+
+		return nil
+	})
+
+	return added, err
+}
+
+// DeleteAcks removes acks of alerts and returns removed ones
+func (s *Store) DeleteAcks(fingerprints []string) ([]Ack, error) {
+	removed := make([]Ack, 0)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(acksBucket)
+
+		for _, fingerprint := range fingerprints {
+			value := bucket.Get([]byte(fingerprint))
+			if value == nil {
+				continue
+			}
+
+			ack := Ack{}
+			if err := json.Unmarshal(value, &ack); err != nil {
+				return err
+			}
+
+			if err := bucket.Delete([]byte(fingerprint)); err != nil {
+				return err
+			}
+
+			removed = append(removed, ack)
+		}
+
+		return nil
+	})
+
+	return removed, err
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buffers of alerts waiting for delivery
+const (
+	HeldBuffer   = "held"   // alerts arrived during chat quiet hours
+	DigestBuffer = "digest" // alerts for chat periodic digest
+	MutedBuffer  = "muted"  // alerts arrived while chat is muted
+	OutboxBuffer = "outbox" // alerts not delivered before shutdown
+)
+
+// BufferedAlerts is alerts payload delayed for later delivery to chat
+type BufferedAlerts struct {
+	ChatID     int64           `json:"chatId"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// BufferedChat is a chat having buffered alerts
+type BufferedChat struct {
+	ChatID int64
+	Oldest time.Time
+}
+
+func chatKey(chatID int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(chatID))
+
+	return key
+}
+
+func bufferBucket(tx *bolt.Tx, buffer string) (*bolt.Bucket, error) {
+	if tx.Writable() {
+		return tx.CreateBucketIfNotExists([]byte("buffer:" + buffer))
+	}
+
+	return tx.Bucket([]byte("buffer:" + buffer)), nil
+}
+
+// BufferAlerts saves payload to be delivered to chat later
+func (s *Store) BufferAlerts(buffer string, item BufferedAlerts) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		root, err := bufferBucket(tx, buffer)
+		if err != nil {
+			return err
+		}
+
+		bucket, err := root.CreateBucketIfNotExists(chatKey(item.ChatID))
+		if err != nil {
+			return err
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		return put(bucket, timeKey(item.ReceivedAt, seq), item)
+	})
+}
+
+// BufferedChats returns chats having buffered alerts with time of the oldest payload
+func (s *Store) BufferedChats(buffer string) ([]BufferedChat, error) {
+	chats := make([]BufferedChat, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		root, _ := bufferBucket(tx, buffer)
+		if root == nil {
+			return nil
+		}
+
+		return root.ForEach(func(key, _ []byte) error {
+			chat := BufferedChat{ChatID: int64(binary.BigEndian.Uint64(key))}
+
+			if first, _ := root.Bucket(key).Cursor().First(); first != nil {
+				chat.Oldest = time.Unix(0, int64(binary.BigEndian.Uint64(first[:8])))
+			}
+
+			chats = append(chats, chat)
+			return nil
+		})
+	})
+
+	return chats, err
+}
+
+// TakeBuffered removes and returns all alerts buffered for chat, oldest first
+func (s *Store) TakeBuffered(buffer string, chatID int64) ([]BufferedAlerts, error) {
+	result := make([]BufferedAlerts, 0)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		root, err := bufferBucket(tx, buffer)
+		if err != nil {
+			return err
+		}
+
+		bucket := root.Bucket(chatKey(chatID))
+		if bucket == nil {
+			return nil
+		}
+
+		err = bucket.ForEach(func(_, value []byte) error {
+			item := BufferedAlerts{}
+			if err := json.Unmarshal(value, &item); err != nil {
+				return err
+			}
+
+			result = append(result, item)
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return root.DeleteBucket(chatKey(chatID))
+	})
+
+	return result, err
+}
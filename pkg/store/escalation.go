@@ -0,0 +1,77 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var escalationsBucket = []byte("escalations")
+
+// Escalation is a firing alert waiting for acknowledgement
+type Escalation struct {
+	Policy      string    `json:"policy"`
+	Fingerprint string    `json:"fingerprint"`
+	ChatID      int64     `json:"chatId"`
+	StartedAt   time.Time `json:"startedAt"`
+	// index of the next escalation level
+	Level  int       `json:"level"`
+	NextAt time.Time `json:"nextAt"`
+	// alerts group with this alert only
+	Payload json.RawMessage `json:"payload"`
+	// chats alert was escalated to
+	EscalatedChats []int64 `json:"escalatedChats"`
+}
+
+func (e *Escalation) Key() []byte {
+	return []byte(fmt.Sprintf("%d/%s/%s", e.ChatID, e.Policy, e.Fingerprint))
+}
+
+// Escalation returns escalation with the same key, nil when not found
+func (s *Store) Escalation(key []byte) (*Escalation, error) {
+	var escalation *Escalation
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(escalationsBucket).Get(key)
+		if value == nil {
+			return nil
+		}
+
+		escalation = new(Escalation)
+		return json.Unmarshal(value, escalation)
+	})
+
+	return escalation, err
+}
+
+func (s *Store) Escalations() ([]Escalation, error) {
+	result := make([]Escalation, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(escalationsBucket).ForEach(func(_, value []byte) error {
+			escalation := Escalation{}
+			if err := json.Unmarshal(value, &escalation); err != nil {
+				return err
+			}
+
+			result = append(result, escalation)
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+func (s *Store) PutEscalation(escalation *Escalation) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(escalationsBucket), escalation.Key(), escalation)
+	})
+}
+
+func (s *Store) DeleteEscalation(escalation *Escalation) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(escalationsBucket).Delete(escalation.Key())
+	})
+}
@@ -0,0 +1,149 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var historyBucket = []byte("history")
+
+// Notification is an alert delivered to chat
+type Notification struct {
+	Fingerprint string            `json:"fingerprint"`
+	AlertName   string            `json:"alertname"`
+	Labels      map[string]string `json:"labels"`
+	Status      string            `json:"status"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+	Receiver    string            `json:"receiver"`
+	GroupKey    string            `json:"groupKey"`
+	ChatID      int64             `json:"chatId"`
+	MessageIDs  []int             `json:"messageIds"`
+	SentAt      time.Time         `json:"sentAt"`
+}
+
+// HistoryFilter selects notifications, zero fields are not used
+type HistoryFilter struct {
+	AlertName string
+	ChatID    int64
+	// notifications sent in message
+	MessageID int
+	Since     time.Time
+	Limit     int
+}
+
+func (f HistoryFilter) match(n *Notification) bool {
+	if f.AlertName != "" && f.AlertName != n.AlertName {
+		return false
+	}
+
+	if f.ChatID != 0 && f.ChatID != n.ChatID {
+		return false
+	}
+
+	if f.MessageID != 0 && !containsInt(n.MessageIDs, f.MessageID) {
+		return false
+	}
+
+	return true
+}
+
+// AddNotifications saves delivered notifications in one transaction
+func (s *Store) AddNotifications(notifications []Notification) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+
+		for _, n := range notifications {
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			if err := put(bucket, timeKey(n.SentAt, seq), n); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// History returns matched notifications ordered from newest to oldest
+func (s *Store) History(filter HistoryFilter) ([]Notification, error) {
+	result := make([]Notification, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(historyBucket).Cursor()
+
+		var since []byte
+		if !filter.Since.IsZero() {
+			since = timeKey(filter.Since, 0)
+		}
+
+		for key, value := cursor.Last(); key != nil; key, value = cursor.Prev() {
+			if since != nil && string(key) < string(since) {
+				break
+			}
+
+			n := Notification{}
+			if err := json.Unmarshal(value, &n); err != nil {
+				return err
+			}
+
+			if !filter.match(&n) {
+				continue
+			}
+
+			result = append(result, n)
+
+			if filter.Limit > 0 && len(result) >= filter.Limit {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+// PruneHistory removes notifications sent before given time
+func (s *Store) PruneHistory(before time.Time) (int, error) {
+	removed := 0
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(historyBucket)
+		cursor := bucket.Cursor()
+		until := timeKey(before, 0)
+
+		// keys are collected first, deleting under cursor while iterating skips items
+		keys := make([][]byte, 0)
+		for key, _ := cursor.First(); key != nil && string(key) < string(until); key, _ = cursor.Next() {
+			keys = append(keys, key)
+		}
+
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		removed = len(keys)
+
+		return nil
+	})
+
+	return removed, err
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+)
+
+var mutesBucket = []byte("mutes")
+
+// Mute keeps chat quiet until given time, empty matchers mute all alerts
+type Mute struct {
+	ChatID    int64            `json:"chatId"`
+	Until     time.Time        `json:"until"`
+	Matchers  matcher.Matchers `json:"matchers"`
+	CreatedBy string           `json:"createdBy"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+// Mute returns chat mute, nil when chat is not muted
+func (s *Store) Mute(chatID int64) (*Mute, error) {
+	var mute *Mute
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(mutesBucket).Get(chatKey(chatID))
+		if value == nil {
+			return nil
+		}
+
+		mute = new(Mute)
+		return json.Unmarshal(value, mute)
+	})
+
+	return mute, err
+}
+
+func (s *Store) Mutes() ([]Mute, error) {
+	result := make([]Mute, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(mutesBucket).ForEach(func(_, value []byte) error {
+			mute := Mute{}
+			if err := json.Unmarshal(value, &mute); err != nil {
+				return err
+			}
+
+			result = append(result, mute)
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+// PutMute saves chat mute, previous mute of the chat is replaced
+func (s *Store) PutMute(mute Mute) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx.Bucket(mutesBucket), chatKey(mute.ChatID), mute)
+	})
+}
+
+// DeleteMute removes chat mute, reports false when chat was not muted
+func (s *Store) DeleteMute(chatID int64) (bool, error) {
+	deleted := false
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(mutesBucket)
+
+		if bucket.Get(chatKey(chatID)) == nil {
+			return nil
+		}
+
+		deleted = true
+
+		return bucket.Delete(chatKey(chatID))
+	})
+
+	return deleted, err
+}
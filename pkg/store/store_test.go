@@ -0,0 +1,133 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) *Store {
+	s, err := Open(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+func TestPruneHistory(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	err := s.AddNotifications([]Notification{
+		{AlertName: "old", ChatID: 1, SentAt: now.Add(-2 * time.Hour)},
+		{AlertName: "boundary", ChatID: 1, SentAt: now.Add(-time.Hour)},
+		{AlertName: "new", ChatID: 1, SentAt: now},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// notification sent exactly at cutoff is kept
+	removed, err := s.PruneHistory(now.Add(-time.Hour))
+	if err != nil || removed != 1 {
+		t.Fatalf("expected one notification removed, got %d %v", removed, err)
+	}
+
+	history, _ := s.History(HistoryFilter{})
+	if len(history) != 2 || history[0].AlertName != "new" || history[1].AlertName != "boundary" {
+		t.Errorf("expected newest first without pruned notification, got %+v", history)
+	}
+
+	if removed, _ := s.PruneHistory(now.Add(-time.Hour)); removed != 0 {
+		t.Errorf("expected nothing to remove twice, got %d", removed)
+	}
+
+	if removed, _ := s.PruneHistory(now.Add(time.Second)); removed != 2 {
+		t.Errorf("expected all notifications removed, got %d", removed)
+	}
+}
+
+func TestTakeBuffered(t *testing.T) {
+	s := openTestStore(t)
+	now := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	items := []BufferedAlerts{
+		{ChatID: 1, ReceivedAt: now.Add(time.Minute), Payload: []byte(`"second"`)},
+		{ChatID: 1, ReceivedAt: now, Payload: []byte(`"first"`)},
+		{ChatID: 1, ReceivedAt: now.Add(time.Minute), Payload: []byte(`"third"`)},
+		{ChatID: 2, ReceivedAt: now, Payload: []byte(`"other chat"`)},
+	}
+
+	for _, item := range items {
+		if err := s.BufferAlerts(HeldBuffer, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	chats, err := s.BufferedChats(HeldBuffer)
+	if err != nil || len(chats) != 2 || chats[0].ChatID != 1 || !chats[0].Oldest.Equal(now) {
+		t.Fatalf("expected two chats with oldest payload time, got %+v %v", chats, err)
+	}
+
+	taken, err := s.TakeBuffered(HeldBuffer, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payloads := []string{}
+	for _, item := range taken {
+		payloads = append(payloads, string(item.Payload))
+	}
+
+	// same time keeps order of buffering
+	if len(payloads) != 3 || payloads[0] != `"first"` || payloads[1] != `"second"` || payloads[2] != `"third"` {
+		t.Errorf("expected payloads oldest first, got %v", payloads)
+	}
+
+	if taken, _ := s.TakeBuffered(HeldBuffer, 1); len(taken) != 0 {
+		t.Errorf("expected chat buffer to be empty after take, got %d", len(taken))
+	}
+
+	if chats, _ := s.BufferedChats(HeldBuffer); len(chats) != 1 || chats[0].ChatID != 2 {
+		t.Errorf("expected only other chat buffered, got %+v", chats)
+	}
+
+	if chats, _ := s.BufferedChats(DigestBuffer); len(chats) != 0 {
+		t.Errorf("expected buffers to be separate, got %+v", chats)
+	}
+}
+
+func TestDeleteMissing(t *testing.T) {
+	s := openTestStore(t)
+
+	subscription := &Subscription{ChatID: 1}
+	if err := s.AddSubscription(subscription); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted, err := s.DeleteSubscription(1, subscription.ID+1); deleted || err != nil {
+		t.Errorf("expected unknown subscription not to be deleted, got %v %v", deleted, err)
+	}
+
+	if deleted, err := s.DeleteSubscription(2, subscription.ID); deleted || err != nil {
+		t.Errorf("expected subscription of other chat not to be deleted, got %v %v", deleted, err)
+	}
+
+	if deleted, _ := s.DeleteSubscription(1, subscription.ID); !deleted {
+		t.Errorf("expected subscription to be deleted")
+	}
+
+	if deleted, err := s.DeleteMute(1); deleted || err != nil {
+		t.Errorf("expected missing mute not to be deleted, got %v %v", deleted, err)
+	}
+
+	if err := s.PutMute(Mute{ChatID: 1, Until: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	if deleted, _ := s.DeleteMute(1); !deleted {
+		t.Errorf("expected mute to be deleted")
+	}
+}
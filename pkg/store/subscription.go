@@ -0,0 +1,96 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+)
+
+var subscriptionsBucket = []byte("subscriptions")
+
+// Subscription routes alerts matching all matchers to chat
+type Subscription struct {
+	ID        uint64           `json:"id"`
+	ChatID    int64            `json:"chatId"`
+	Matchers  matcher.Matchers `json:"matchers"`
+	CreatedBy string           `json:"createdBy"`
+	CreatedAt time.Time        `json:"createdAt"`
+}
+
+func subscriptionKey(id uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, id)
+
+	return key
+}
+
+// AddSubscription saves subscription and assigns its id
+func (s *Store) AddSubscription(subscription *Subscription) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subscriptionsBucket)
+
+		id, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		subscription.ID = id
+
+		return put(bucket, subscriptionKey(id), subscription)
+	})
+}
+
+// Subscriptions returns subscriptions ordered by id, chatID 0 returns subscriptions of all chats
+func (s *Store) Subscriptions(chatID int64) ([]Subscription, error) {
+	result := make([]Subscription, 0)
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(subscriptionsBucket).ForEach(func(_, value []byte) error {
+			subscription := Subscription{}
+			if err := json.Unmarshal(value, &subscription); err != nil {
+				return err
+			}
+
+			if chatID == 0 || subscription.ChatID == chatID {
+				result = append(result, subscription)
+			}
+
+			return nil
+		})
+	})
+
+	return result, err
+}
+
+// DeleteSubscription removes chat subscription, reports false when chat has no such subscription
+func (s *Store) DeleteSubscription(chatID int64, id uint64) (bool, error) {
+	deleted := false
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(subscriptionsBucket)
+
+		value := bucket.Get(subscriptionKey(id))
+		if value == nil {
+			return nil
+		}
+
+		subscription := Subscription{}
+		if err := json.Unmarshal(value, &subscription); err != nil {
+			return err
+		}
+
+		if subscription.ChatID != chatID {
+			return nil
+		}
+
+		deleted = true
+
+		return bucket.Delete(subscriptionKey(id))
+	})
+
+	return deleted, err
+}
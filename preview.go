@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+)
+
+var sampleNameRegexp = regexp.MustCompile(`^[\w-]+$`)
+
+// Telegram supports only small subset of html tags, all other markup is shown as is
+var (
+	telegramTagsRegexp = regexp.MustCompile(`&lt;(/?)(b|strong|i|em|u|ins|s|strike|del|code|pre)&gt;`)
+	telegramLinkRegexp = regexp.MustCompile(`&lt;a href=&#34;(https?://[^&]*?)&#34;&gt;`)
+	telegramLinkEnd    = regexp.MustCompile(`&lt;/a&gt;`)
+)
+
+type PreviewPage struct {
+	Number int    `json:"number"`
+	Bytes  int    `json:"bytes"`
+	Text   string `json:"text"`
+}
+
+type PreviewResponse struct {
+	Layout           string        `json:"layout"`
+	MessageTemplate  string        `json:"message_template"`
+	GroupByAlertName bool          `json:"group_by_alert_name"`
+	Pages            []PreviewPage `json:"pages"`
+}
+
+// HTTPPreviewHandler renders alerts payload (request body or stored sample)
+// with selected templates and returns pages without sending them to Telegram.
+//
+// Query params:
+//   layout              - layout name, default "prometheus"
+//   message_template    - message template name, default "prometheus"
+//   group_by_alert_name - "true" or "false", default "true"
+//   firing_template     - message template of firing alerts, default message_template
+//   resolved_template   - message template of resolved alerts, default message_template
+//   firing_layout       - layout of firing notifications, default layout
+//   resolved_layout     - layout of resolved notifications, default layout
+//   sample              - sample payload name from samples_path, used when body is empty
+//   format              - "json" (default) or "html"
+func (app *Application) HTTPPreviewHandler(c *gin.Context) {
+	selectedLayout := appconfig.SelectedLayout{
+		Layout:           c.DefaultQuery("layout", "prometheus"),
+		MessageTemplate:  c.DefaultQuery("message_template", "prometheus"),
+		GroupByAlertName: true,
+		FiringTemplate:   c.Query("firing_template"),
+		ResolvedTemplate: c.Query("resolved_template"),
+		FiringLayout:     c.Query("firing_layout"),
+		ResolvedLayout:   c.Query("resolved_layout"),
+	}
+
+	if groupParam := c.Query("group_by_alert_name"); groupParam != "" {
+		groupBy, err := strconv.ParseBool(groupParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": "group_by_alert_name should be boolean"})
+			return
+		}
+
+		selectedLayout.GroupByAlertName = groupBy
+	}
+
+	for _, layout := range []string{selectedLayout.Layout, selectedLayout.FiringLayout, selectedLayout.ResolvedLayout} {
+		if _, ok := app.config.Layouts[layout]; layout != "" && !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": fmt.Sprintf("unknown layout %q", layout)})
+			return
+		}
+	}
+
+	for _, messageTemplate := range []string{selectedLayout.MessageTemplate, selectedLayout.FiringTemplate, selectedLayout.ResolvedTemplate} {
+		if _, ok := app.config.MessageTemplates[messageTemplate]; messageTemplate != "" && !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": fmt.Sprintf("unknown message template %q", messageTemplate)})
+			return
+		}
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"desc": "cannot read request body", "errstr": err.Error()})
+		return
+	}
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		body, err = app.loadSample(c.Query("sample"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"desc": "no alerts provided", "errstr": err.Error()})
+			return
+		}
+	}
+
+	alerts := new(Alerts)
+	if err := json.Unmarshal(body, alerts); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"info":   "alerts data invalid",
+			"errstr": err.Error(),
+		})
+
+		return
+	}
+
+	pages, err := app.RenderAlerts(alerts, selectedLayout)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"desc": "render failed", "errstr": err.Error()})
+		return
+	}
+
+	response := PreviewResponse{
+		Layout:           selectedLayout.Layout,
+		MessageTemplate:  selectedLayout.MessageTemplate,
+		GroupByAlertName: selectedLayout.GroupByAlertName,
+		Pages:            make([]PreviewPage, 0, len(pages)),
+	}
+
+	for idx, page := range pages {
+		response.Pages = append(response.Pages, PreviewPage{Number: idx, Bytes: page.Len(), Text: page.String()})
+	}
+
+	if c.Query("format") == "html" {
+		out := new(bytes.Buffer)
+		if err := previewPageTemplate.Execute(out, response); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		c.Data(http.StatusOK, "text/html; charset=utf-8", out.Bytes())
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (app *Application) loadSample(name string) ([]byte, error) {
+	if name == "" {
+		return nil, fmt.Errorf("empty body and no sample param given")
+	}
+
+	if !sampleNameRegexp.MatchString(name) {
+		return nil, fmt.Errorf("invalid sample name %q", name)
+	}
+
+	return ioutil.ReadFile(filepath.Join(app.config.SamplesPath, name+".json"))
+}
+
+// telegramHTML escapes rendered message and restores only tags allowed by Telegram HTML parse mode
+func telegramHTML(text string) template.HTML {
+	escaped := html.EscapeString(text)
+	escaped = telegramTagsRegexp.ReplaceAllString(escaped, "<$1$2>")
+	escaped = telegramLinkRegexp.ReplaceAllString(escaped, `<a href="$1">`)
+	escaped = telegramLinkEnd.ReplaceAllString(escaped, "</a>")
+
+	return template.HTML(escaped)
+}
+
+var previewPageTemplate = template.Must(template.New("preview").Funcs(template.FuncMap{
+	"TelegramHTML": telegramHTML,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>prometheus_tbot preview: {{ .Layout }} / {{ .MessageTemplate }}</title>
+<style>
+	body { background: #0e1621; font-family: -apple-system, "Segoe UI", Roboto, sans-serif; margin: 0; padding: 24px; }
+	.info { color: #708499; font-size: 13px; margin-bottom: 16px; }
+	.bubble { background: #182533; color: #f5f5f5; border-radius: 12px; max-width: 480px; padding: 8px 12px; margin-bottom: 8px; font-size: 15px; line-height: 1.35; white-space: pre-wrap; word-wrap: break-word; }
+	.bubble code, .bubble pre { font-family: Menlo, Consolas, monospace; color: #7ab3e5; }
+	.bubble a { color: #6ab3f3; }
+	.meta { color: #6d7f8f; font-size: 12px; text-align: right; }
+</style>
+</head>
+<body>
+<div class="info">layout: {{ .Layout }}, message template: {{ .MessageTemplate }}, grouped: {{ .GroupByAlertName }}, pages: {{ len .Pages }}</div>
+{{ range .Pages }}<div class="bubble">{{ TelegramHTML .Text }}<div class="meta">page {{ .Number }} &middot; {{ .Bytes }} bytes</div></div>
+{{ end }}
+</body>
+</html>
+`))
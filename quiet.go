@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/schedule"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+const heldAlertsCheckInterval = time.Minute
+
+func (app *Application) chatSchedule(chatID int64) *schedule.Schedule {
+	if chatLayoutConfig, ok := app.config.ChatsLayouts[strconv.FormatInt(chatID, 10)]; ok {
+		return chatLayoutConfig.Schedule
+	}
+
+	return nil
+}
+
+// splitQuietAlerts separates alerts arrived during chat quiet hours. Alerts with severity
+// at least schedule min_severity are delivered as usual. Returned groups are nil when empty
+func (app *Application) splitQuietAlerts(alerts *Alerts, chatID int64, now time.Time) (notify *Alerts, quiet *Alerts) {
+	chatSchedule := app.chatSchedule(chatID)
+
+	if chatSchedule == nil || chatSchedule.Active(now) {
+		return alerts, nil
+	}
+
+	urgent := make([]Alert, 0)
+	other := make([]Alert, 0)
+
+	for _, alert := range alerts.Alerts {
+		severity := fmt.Sprint(alert.Labels[app.config.SeverityLabel])
+
+		if chatSchedule.MinSeverity != "" && app.config.SeverityRank(severity) >= app.config.SeverityRank(chatSchedule.MinSeverity) {
+			urgent = append(urgent, alert)
+		} else {
+			other = append(other, alert)
+		}
+	}
+
+	if len(urgent) > 0 {
+		notify = alerts.WithAlerts(urgent)
+	}
+
+	if len(other) > 0 {
+		quiet = alerts.WithAlerts(other)
+	}
+
+	return
+}
+
+func (app *Application) handleQuietAlerts(alerts *Alerts, chatID int64) {
+	action := app.chatSchedule(chatID).QuietAction
+
+	if action == schedule.ActionHold && app.store == nil {
+		log.Println("Cannot hold alerts without state_path, sending silently:", chatID)
+		action = schedule.ActionSilent
+	}
+
+	switch action {
+	case schedule.ActionDrop:
+		if app.config.Debug {
+			log.Println("Dropped alerts during quiet hours:", chatID, len(alerts.Alerts))
+		}
+	case schedule.ActionHold:
+		if err := app.bufferAlerts(store.HeldBuffer, alerts, chatID); err != nil {
+			log.Println("Error while holding alerts, sending silently:", chatID, err)
+			app.send(alerts, chatID, SendOptions{Silent: true})
+		}
+	default:
+		app.send(alerts, chatID, SendOptions{Silent: true})
+	}
+}
+
+// releaseHeldAlerts periodically delivers alerts held for chats whose quiet hours are over
+func (app *Application) releaseHeldAlerts() {
+	app.every(heldAlertsCheckInterval, app.flushHeldAlerts)
+}
+
+// flushHeldAlerts delivers held alerts as digest when chat quiet hours are over
+func (app *Application) flushHeldAlerts(now time.Time) {
+	chats, err := app.store.BufferedChats(store.HeldBuffer)
+	if err != nil {
+		log.Println("Error while reading held alerts:", err)
+		return
+	}
+
+	for _, chat := range chats {
+		if chatSchedule := app.chatSchedule(chat.ChatID); chatSchedule != nil && !chatSchedule.Active(now) {
+			continue
+		}
+
+		held, err := app.store.TakeBuffered(store.HeldBuffer, chat.ChatID)
+		if err != nil {
+			log.Println("Error while taking held alerts:", chat.ChatID, err)
+			continue
+		}
+
+		if app.keepUndelivered(store.HeldBuffer, held) {
+			return
+		}
+
+		view := app.buildDigest(held, now)
+		view.Held = true
+
+		app.sendDigest(chat.ChatID, view, SendOptions{})
+	}
+}
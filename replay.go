@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/recorder"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+// replayCommand feeds recorded webhooks back through rendering. Pages are printed
+// to stdout, or sent to test chat when -chat given.
+//
+//	prometheus_tbot replay -c config.yml -f recorded.jsonl [-chat 12345] [-speed 10] [-only-chat -100500]
+func replayCommand(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := flags.String(appconfig.ConfigPathFlag, os.Getenv(appconfig.EnvPrefix+"_CONFIG_PATH"), "Path to config file")
+	recordPath := flags.String("f", "", "Path to recorded webhooks JSONL file, default is record_path from config")
+	telegramToken := flags.String(appconfig.TelegramTokenFlag, os.Getenv(appconfig.EnvPrefix+"_TELEGRAM_TOKEN"), "Telegram token, required with -chat")
+	targetChat := flags.Int64("chat", 0, "Send rendered messages to this chat instead of stdout")
+	onlyChat := flags.Int64("only-chat", 0, "Replay only webhooks delivered to this chat")
+	speed := flags.Float64("speed", 0, "Replay speed: 1 keeps original delays between webhooks, 10 is ten times faster, 0 replays without delays")
+	flags.Parse(args)
+
+	config := new(appconfig.Config)
+
+	if *configPath != "" {
+		loaded, err := appconfig.Load(*configPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		config = loaded
+	} else {
+		config.Finalize()
+	}
+
+	if *recordPath == "" {
+		*recordPath = config.RecordPath
+	}
+
+	if *recordPath == "" {
+		fmt.Fprintln(os.Stderr, "no records file provided, use -f path/to/recorded.jsonl")
+		return 2
+	}
+
+	records, err := recorder.ReadFile(*recordPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	app := NewApplicationWithConfig(config)
+	// do not record replayed webhooks again
+	app.recorder = nil
+
+	bots := []*Application{app}
+	for _, child := range app.bots {
+		bots = append(bots, child)
+	}
+
+	// subscriptions from state route webhooks without chat ids
+	for _, bot := range bots {
+		if bot.config.StatePath == "" {
+			continue
+		}
+
+		if bot.store, err = store.Open(bot.config.StatePath); err != nil {
+			fmt.Fprintf(os.Stderr, "cant open state %v, subscriptions are not replayed: %v\n", bot.config.StatePath, err)
+			continue
+		}
+
+		defer bot.store.Close()
+	}
+
+	if *targetChat != 0 {
+		if *telegramToken == "" {
+			*telegramToken = config.TelegramToken
+		}
+
+		bot, err := tgbotapi.NewBotAPI(*telegramToken)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "cant start bot:", err)
+			return 1
+		}
+
+		app.bot = bot
+	}
+
+	app.replay(records, replayOptions{targetChat: *targetChat, onlyChat: *onlyChat, speed: *speed}, os.Stdout, time.Sleep)
+
+	return 0
+}
+
+type replayOptions struct {
+	targetChat int64
+	onlyChat   int64
+	speed      float64
+}
+
+// recordBot returns bot which received record, records made before bot name was
+// recorded are matched by path
+func (app *Application) recordBot(record recorder.Record) (*Application, error) {
+	if record.Bot != "" {
+		bot, ok := app.bots[record.Bot]
+		if !ok {
+			return nil, fmt.Errorf("bot %q is not configured", record.Bot)
+		}
+
+		return bot, nil
+	}
+
+	bot, _ := app.alertBot(strings.TrimPrefix(record.Path, "/alert"))
+
+	return bot, nil
+}
+
+// replay renders records as they were delivered, pages are written to out or sent to
+// options.targetChat. Records are routed like webhooks: by bot, chat ids and subscriptions.
+// sleep waits between records when speed is set
+func (app *Application) replay(records []recorder.Record, options replayOptions, out io.Writer, sleep func(time.Duration)) {
+	for idx, record := range records {
+		if idx > 0 && options.speed > 0 {
+			sleep(time.Duration(float64(record.Time.Sub(records[idx-1].Time)) / options.speed))
+		}
+
+		alerts := new(Alerts)
+		if err := json.Unmarshal(record.Payload, alerts); err != nil {
+			fmt.Fprintf(os.Stderr, "record %d: alerts data invalid: %v\n", idx, err)
+			continue
+		}
+
+		bot, err := app.recordBot(record)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "record %d: %v\n", idx, err)
+			continue
+		}
+
+		for _, route := range bot.routeAlerts(alerts, record.ChatIDs) {
+			chatID := route.chatID
+			if options.onlyChat != 0 && chatID != options.onlyChat {
+				continue
+			}
+
+			pages, err := bot.RenderAlerts(route.alerts, bot.SelectLayout(chatID))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "record %d: chat %d: %v\n", idx, chatID, err)
+				continue
+			}
+
+			if options.targetChat != 0 {
+				app.SendPages(options.targetChat, pages, SendOptions{})
+				continue
+			}
+
+			for pageIdx, page := range pages {
+				fmt.Fprintf(out, "=== %v receiver=%v chat=%d page=%d\n%s\n", record.Time.Format(time.RFC3339), route.alerts.Receiver, chatID, pageIdx, page.String())
+			}
+		}
+	}
+}
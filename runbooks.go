@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/pechorin/prometheus_tbot/pkg/runbook"
+)
+
+// runbooks attached to one notification
+const runbooksLimit = 3
+
+// Telegram message length limit in characters
+const telegramMessageLimit = 4096
+
+// escapeLimit escapes text for HTML message and cuts it so escaped text is not longer
+// than limit characters, entities are not cut
+func escapeLimit(text string, limit int) string {
+	escaped := html.EscapeString(text)
+	if utf8.RuneCountInString(escaped) <= limit {
+		return escaped
+	}
+
+	cut := new(strings.Builder)
+	length := 0
+
+	for _, r := range text {
+		char := html.EscapeString(string(r))
+		// place for ellipsis
+		if length+utf8.RuneCountInString(char) > limit-1 {
+			break
+		}
+
+		cut.WriteString(char)
+		length += utf8.RuneCountInString(char)
+	}
+
+	cut.WriteString("…")
+
+	return cut.String()
+}
+
+// runbookLinks returns unique runbook_url annotations of firing alerts with alert names
+func runbookLinks(alerts *Alerts, limit int) (urls []string, names []string) {
+	seen := make(map[string]bool)
+
+	for _, alert := range alerts.Firing() {
+		if len(urls) >= limit {
+			break
+		}
+
+		runbookURL, ok := alert.Annotations["runbook_url"].(string)
+		if !ok || runbookURL == "" || seen[runbookURL] {
+			continue
+		}
+
+		seen[runbookURL] = true
+		urls = append(urls, runbookURL)
+		names = append(names, alert.StringLabels()["alertname"])
+	}
+
+	return
+}
+
+// sendRunbooks replies to alert message with configured section of each alert runbook
+// as expandable quote. Runbooks which can't be read are skipped
+func (app *Application) sendRunbooks(alerts *Alerts, chatID int64, messageID int, now time.Time) {
+	if app.runbooks == nil {
+		return
+	}
+
+	urls, names := runbookLinks(alerts, runbooksLimit)
+
+	for idx, runbookURL := range urls {
+		markdown, err := app.runbooks.Fetch(runbookURL, now)
+		if err != nil {
+			if err != runbook.ErrNoSource {
+				log.Println("Error while reading runbook:", runbookURL, err)
+			}
+
+			continue
+		}
+
+		section := runbook.Section(markdown, app.config.Runbooks.Section, app.config.Runbooks.MaxLength)
+		if section == "" {
+			continue
+		}
+
+		// each runbook is sent in own reply, so long sections fit in Telegram message
+		header := fmt.Sprintf("📖 <a href=\"%v\">%v</a>\n<blockquote expandable>",
+			html.EscapeString(runbookURL), html.EscapeString(names[idx]))
+		footer := "</blockquote>"
+
+		limit := telegramMessageLimit - utf8.RuneCountInString(header) - utf8.RuneCountInString(footer)
+		if limit <= 0 {
+			log.Println("Runbook link is too long:", runbookURL)
+			continue
+		}
+
+		text := bytes.NewBufferString(header + escapeLimit(section, limit) + footer)
+		app.SendPages(chatID, []*bytes.Buffer{text}, SendOptions{Silent: true, ReplyTo: messageID})
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+// requests to Telegram and Prometheus running when shutdown timeout is over are waited
+// this long, they are not canceled
+const abortTimeout = 2 * time.Second
+
+// waitShutdown stops server on SIGTERM or SIGINT and drains deliveries of bots
+func (app *Application) waitShutdown(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+
+	sig := <-signals
+	log.Printf("Got %v, shutting down", sig)
+
+	deadline := time.Now().Add(app.config.ShutdownTimeout.Duration)
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	// stops accepting webhooks and waits for running handlers
+	if err := server.Shutdown(ctx); err != nil {
+		log.Println("Error while stopping server:", err)
+	}
+
+	bots := []*Application{app}
+	for _, child := range app.bots {
+		bots = append(bots, child)
+	}
+
+	// background jobs of all bots stop before any bot waits for deliveries
+	for _, bot := range bots {
+		bot.stop()
+	}
+
+	// app goes first, its leader job of cluster replica leads additional bots
+	for _, bot := range bots {
+		bot.drain(deadline)
+	}
+}
+
+// runJob runs background job of bot, drain waits for running jobs
+func (app *Application) runJob(job func()) {
+	app.jobs.Add(1)
+
+	go func() {
+		defer app.jobs.Done()
+
+		job()
+	}()
+}
+
+// every calls job each interval until shutdown starts
+func (app *Application) every(interval time.Duration, job func(now time.Time)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-app.ctx.Done():
+			return
+		case now := <-ticker.C:
+			// job is waited as delivery, shutdown timeout aborts it
+			app.deliveries.Add(1)
+			job(now)
+			app.deliveries.Done()
+		}
+	}
+}
+
+// drain waits until stopped background jobs return and in-flight deliveries finish.
+// After deadline deliveries are aborted and alerts left are saved to outbox. State
+// is closed when nothing uses it anymore
+func (app *Application) drain(deadline time.Time) {
+	done := make(chan struct{})
+	go func() {
+		// stopped jobs do not start deliveries, so deliveries are waited after them
+		app.jobs.Wait()
+		app.deliveries.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Until(deadline)):
+		log.Println("Shutdown timeout is over, saving undelivered alerts")
+	}
+
+	app.abortDeliveries()
+
+	// request being sent is finished, but hung one does not hold shutdown
+	select {
+	case <-done:
+	case <-time.After(time.Until(deadline.Add(abortTimeout))):
+		log.Println("Deliveries are not finished after timeout, closing state")
+	}
+
+	if app.store != nil {
+		if err := app.store.Close(); err != nil {
+			log.Println("Error while closing state:", err)
+		}
+	}
+}
+
+// deliveriesAborted reports whether shutdown timeout is over
+func (app *Application) deliveriesAborted() bool {
+	return app.deliveryCtx.Err() != nil
+}
+
+// keepUndelivered puts alerts taken from buffer back when shutdown timeout is over, so
+// digests and held alerts are sent the same way after restart. Reports whether alerts
+// should not be sent
+func (app *Application) keepUndelivered(buffer string, buffered []store.BufferedAlerts) bool {
+	if !app.deliveriesAborted() {
+		return false
+	}
+
+	for _, item := range buffered {
+		if err := app.store.BufferAlerts(buffer, item); err != nil {
+			log.Println("Error while saving undelivered alerts:", item.ChatID, err)
+		}
+	}
+
+	return true
+}
+
+// saveUndelivered keeps alerts in outbox to be delivered after restart
+func (app *Application) saveUndelivered(route routedAlerts) {
+	if app.store == nil {
+		log.Println("Alerts not delivered before shutdown are lost without state_path:", route.chatID)
+		return
+	}
+
+	if err := app.bufferAlerts(store.OutboxBuffer, route.alerts, route.chatID); err != nil {
+		log.Println("Error while saving undelivered alerts:", route.chatID, err)
+	}
+}
+
+// flushOutbox delivers alerts saved on previous shutdown
+func (app *Application) flushOutbox() {
+	chats, err := app.store.BufferedChats(store.OutboxBuffer)
+	if err != nil {
+		log.Println("Error while reading outbox:", err)
+		return
+	}
+
+	for _, chat := range chats {
+		undelivered, err := app.store.TakeBuffered(store.OutboxBuffer, chat.ChatID)
+		if err != nil {
+			log.Println("Error while taking outbox alerts:", chat.ChatID, err)
+			continue
+		}
+
+		for idx, item := range undelivered {
+			if app.keepUndelivered(store.OutboxBuffer, undelivered[idx:]) {
+				return
+			}
+
+			alerts := new(Alerts)
+			if err := json.Unmarshal(item.Payload, alerts); err != nil {
+				log.Println("Error while reading outbox alerts:", chat.ChatID, err)
+				continue
+			}
+
+			app.deliver(alerts, chat.ChatID)
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"strings"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/alertmanager"
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+)
+
+const (
+	expireCallbackPrefix = "expire:"
+
+	// max silences listed by /silences
+	silencesCommandLimit = 20
+)
+
+// silencesDisabled returns reason why silences cannot be managed, empty when available
+func (app *Application) silencesDisabled() string {
+	if app.alertmanager == nil {
+		return "Silences are disabled, set alertmanager_url in config"
+	}
+
+	return ""
+}
+
+// parseSilenceArgs parses "matcher... duration [reason]"
+func parseSilenceArgs(args []string) (matchers matcher.Matchers, duration time.Duration, reason string, err error) {
+	for idx, arg := range args {
+		if parsed, durationErr := appconfig.ParseDuration(arg); durationErr == nil {
+			if parsed <= 0 {
+				return nil, 0, "", fmt.Errorf("duration should be positive")
+			}
+
+			duration = parsed
+			reason = strings.Join(args[idx+1:], " ")
+			break
+		}
+
+		m, matcherErr := matcher.Parse(arg)
+		if matcherErr != nil {
+			return nil, 0, "", matcherErr
+		}
+
+		matchers = append(matchers, m)
+	}
+
+	if len(matchers) == 0 {
+		return nil, 0, "", fmt.Errorf("at least one matcher is required")
+	}
+
+	if duration == 0 {
+		return nil, 0, "", fmt.Errorf("duration is required")
+	}
+
+	return matchers, duration, reason, nil
+}
+
+// silenceCommand handles /silence alertname=X instance=~db.* 2h reason text
+func (app *Application) silenceCommand(message *tgbotapi.Message, args []string) {
+	if disabled := app.silencesDisabled(); disabled != "" {
+		app.replyText(message, html.EscapeString(disabled), nil)
+		return
+	}
+
+	matchers, duration, reason, err := parseSilenceArgs(args)
+	if err != nil {
+		app.replyText(message, fmt.Sprintf("%v\nUsage: <code>/silence alertname=X instance=~db.* 2h reason</code>", html.EscapeString(err.Error())), nil)
+		return
+	}
+
+	if reason == "" {
+		reason = "Silenced from Telegram"
+	}
+
+	now := time.Now()
+	silence := alertmanager.Silence{
+		Matchers:  alertmanager.FromMatchers(matchers),
+		StartsAt:  now,
+		EndsAt:    now.Add(duration),
+		CreatedBy: userName(message.From),
+		Comment:   reason,
+	}
+
+	id, err := app.alertmanager.CreateSilence(silence)
+	if err != nil {
+		log.Println("Error while creating silence:", err)
+		app.replyText(message, "Cannot create silence: "+html.EscapeString(err.Error()), nil)
+		return
+	}
+
+	app.replyText(message, fmt.Sprintf("🔕 Silence <code>%v</code> created until %v\n%v",
+		html.EscapeString(id), app.formatTime(silence.EndsAt), html.EscapeString(matchers.String())), nil)
+}
+
+// silencesCommand lists active silences with buttons to expire them
+func (app *Application) silencesCommand(message *tgbotapi.Message, args []string) {
+	if app.alertmanager == nil {
+		app.replyText(message, "Silences are disabled, set <code>alertmanager_url</code> in config", nil)
+		return
+	}
+
+	silences, err := app.alertmanager.Silences()
+	if err != nil {
+		log.Println("Error while reading silences:", err)
+		app.replyText(message, "Cannot read silences: "+html.EscapeString(err.Error()), nil)
+		return
+	}
+
+	text := new(bytes.Buffer)
+	rows := make([][]tgbotapi.InlineKeyboardButton, 0)
+	active := 0
+
+	for _, silence := range silences {
+		if !silence.Active() {
+			continue
+		}
+
+		active++
+		if active > silencesCommandLimit {
+			continue
+		}
+
+		matchers := make([]string, 0, len(silence.Matchers))
+		for _, m := range silence.Matchers {
+			matchers = append(matchers, m.String())
+		}
+
+		fmt.Fprintf(text, "\n<code>%v</code> until %v by %v\n%v",
+			html.EscapeString(shortID(silence.ID)), app.formatTime(silence.EndsAt),
+			html.EscapeString(silence.CreatedBy), html.EscapeString(strings.Join(matchers, " ")))
+
+		if silence.Comment != "" {
+			fmt.Fprintf(text, "\n<i>%v</i>", html.EscapeString(silence.Comment))
+		}
+
+		text.WriteString("\n")
+
+		rows = append(rows, tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonData("🔔 Expire "+shortID(silence.ID), expireCallbackPrefix+silence.ID),
+		))
+	}
+
+	if active > silencesCommandLimit {
+		fmt.Fprintf(text, "\n... and %d more", active-silencesCommandLimit)
+	}
+
+	header := fmt.Sprintf("<b>Active silences: %d</b>\n", active)
+
+	if len(rows) == 0 {
+		app.replyText(message, header, nil)
+		return
+	}
+
+	app.replyText(message, header+text.String(), tgbotapi.NewInlineKeyboardMarkup(rows...))
+}
+
+// unsilenceCommand handles /unsilence <id>
+func (app *Application) unsilenceCommand(message *tgbotapi.Message, args []string) {
+	app.replyText(message, html.EscapeString(app.expireSilence(args[0], message.From)), nil)
+}
+
+// expireSilence expires silence and returns text for user
+func (app *Application) expireSilence(id string, user *tgbotapi.User) string {
+	if disabled := app.silencesDisabled(); disabled != "" {
+		return disabled
+	}
+
+	id, err := app.findSilenceID(id)
+	if err != nil {
+		return err.Error()
+	}
+
+	if err := app.alertmanager.ExpireSilence(id); err != nil {
+		log.Println("Error while expiring silence:", id, err)
+		return "Cannot expire silence: " + err.Error()
+	}
+
+	return fmt.Sprintf("🔔 Silence %v expired by %v", id, userName(user))
+}
+
+// findSilenceID finds active silence by id or its short form from /silences list
+func (app *Application) findSilenceID(id string) (string, error) {
+	silences, err := app.alertmanager.Silences()
+	if err != nil {
+		log.Println("Error while reading silences:", err)
+		return "", fmt.Errorf("Cannot read silences: %v", err)
+	}
+
+	found := make([]string, 0, 1)
+	for _, silence := range silences {
+		if silence.ID == id {
+			return id, nil
+		}
+
+		if silence.Active() && strings.HasPrefix(silence.ID, id) {
+			found = append(found, silence.ID)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("Silence %v not found", id)
+	case 1:
+		return found[0], nil
+	default:
+		return "", fmt.Errorf("Silence id %v is ambiguous, use full id", id)
+	}
+}
+
+// shortID returns first part of silence uuid, enough to tell silences apart in list
+func shortID(id string) string {
+	if idx := strings.Index(id, "-"); idx > 0 {
+		return id[:idx]
+	}
+
+	return id
+}
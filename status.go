@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// Version is set at build time with -ldflags "-X main.Version=..."
+var Version = "dev"
+
+// statusCommand shows bot health and delivery stats collected since start
+func (app *Application) statusCommand(message *tgbotapi.Message, args []string) {
+	now := time.Now()
+	snapshot := app.stats.Snapshot()
+
+	text := new(bytes.Buffer)
+	fmt.Fprintf(text, "<b>Status</b>\n")
+	fmt.Fprintf(text, "\nVersion: <code>%v</code>", html.EscapeString(Version))
+	fmt.Fprintf(text, "\nUptime: %v", now.Sub(snapshot.StartedAt).Round(time.Second))
+	fmt.Fprintf(text, "\nConfig loaded: %v", app.formatTime(snapshot.ConfigLoadedAt))
+	fmt.Fprintf(text, "\nWebhooks: %d accepted, %d rejected", snapshot.WebhooksAccepted, snapshot.WebhooksRejected)
+	fmt.Fprintf(text, "\nQueue: %d pending deliveries", snapshot.Pending)
+
+	if len(snapshot.Receivers) > 0 {
+		text.WriteString("\n\n<b>Receivers</b>")
+
+		for _, receiver := range snapshot.Receivers {
+			fmt.Fprintf(text, "\n<code>%v</code>: %d webhooks, last at %v",
+				html.EscapeString(receiver.Receiver), receiver.Webhooks, app.formatTime(receiver.LastReceivedAt))
+		}
+	}
+
+	if len(snapshot.Chats) > 0 {
+		text.WriteString("\n\n<b>Chats</b>")
+
+		for _, chat := range snapshot.Chats {
+			fmt.Fprintf(text, "\n<code>%d</code>: %d sent, %d failed", chat.ChatID, chat.Sent, chat.Failed)
+
+			if !chat.LastSentAt.IsZero() {
+				fmt.Fprintf(text, ", last at %v", app.formatTime(chat.LastSentAt))
+			}
+		}
+	}
+
+	if len(snapshot.Errors) > 0 {
+		text.WriteString("\n\n<b>Recent Telegram errors</b>")
+
+		for _, telegramError := range snapshot.Errors {
+			fmt.Fprintf(text, "\n%v <code>%d</code>: %v",
+				app.formatTime(telegramError.Time), telegramError.ChatID, html.EscapeString(telegramError.Error))
+		}
+	}
+
+	app.replyText(message, text.String(), nil)
+}
+
+// HTTPMetricsHandler exposes the same counters as /status in Prometheus format
+func (app *Application) HTTPMetricsHandler(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4")
+	c.Status(http.StatusOK)
+
+	if err := app.stats.WriteMetrics(c.Writer, Version); err != nil {
+		log.Println("Error while writing metrics:", err)
+	}
+}
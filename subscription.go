@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"time"
+
+	"gopkg.in/telegram-bot-api.v4"
+
+	"github.com/pechorin/prometheus_tbot/pkg/matcher"
+	"github.com/pechorin/prometheus_tbot/pkg/store"
+)
+
+// routedAlerts are alerts delivered to one chat
+type routedAlerts struct {
+	chatID int64
+	alerts *Alerts
+}
+
+// routeAlerts returns alerts for chats from webhook URL and for chats subscribed to them.
+// Chats from URL get the whole group, subscribed chats get only matching alerts
+func (app *Application) routeAlerts(alerts *Alerts, chatIDs []int64) []routedAlerts {
+	routes := make([]routedAlerts, 0, len(chatIDs))
+	routed := make(map[int64]bool)
+
+	for _, chatID := range chatIDs {
+		if routed[chatID] {
+			continue
+		}
+
+		routed[chatID] = true
+		routes = append(routes, routedAlerts{chatID: chatID, alerts: alerts})
+	}
+
+	if app.store == nil {
+		return routes
+	}
+
+	subscriptions, err := app.store.Subscriptions(0)
+	if err != nil {
+		log.Println("Error while reading subscriptions:", err)
+		return routes
+	}
+
+	matched := make(map[int64][]Alert)
+	matchedOrder := make([]int64, 0)
+
+	for _, alert := range alerts.Alerts {
+		labels := alert.StringLabels()
+		alertChats := make(map[int64]bool)
+
+		for _, subscription := range subscriptions {
+			if routed[subscription.ChatID] || alertChats[subscription.ChatID] || !subscription.Matchers.Match(labels) {
+				continue
+			}
+
+			alertChats[subscription.ChatID] = true
+
+			if _, ok := matched[subscription.ChatID]; !ok {
+				matchedOrder = append(matchedOrder, subscription.ChatID)
+			}
+
+			matched[subscription.ChatID] = append(matched[subscription.ChatID], alert)
+		}
+	}
+
+	for _, chatID := range matchedOrder {
+		routes = append(routes, routedAlerts{chatID: chatID, alerts: alerts.WithAlerts(matched[chatID])})
+	}
+
+	return routes
+}
+
+func (app *Application) subscriptionsDisabled(message *tgbotapi.Message) bool {
+	if app.store == nil {
+		app.replyText(message, "Subscriptions are disabled, set <code>state_path</code> in config", nil)
+		return true
+	}
+
+	return false
+}
+
+// subscribeCommand handles /subscribe severity=critical team=payments
+func (app *Application) subscribeCommand(message *tgbotapi.Message, args []string) {
+	if app.subscriptionsDisabled(message) {
+		return
+	}
+
+	matchers, err := matcher.ParseAll(args)
+	if err != nil {
+		app.replyText(message, html.EscapeString(err.Error()), nil)
+		return
+	}
+
+	subscription := &store.Subscription{
+		ChatID:    message.Chat.ID,
+		Matchers:  matchers,
+		CreatedBy: userName(message.From),
+		CreatedAt: time.Now(),
+	}
+
+	if err := app.store.AddSubscription(subscription); err != nil {
+		log.Println("Error while saving subscription:", message.Chat.ID, err)
+		app.replyText(message, "Cannot save subscription", nil)
+		return
+	}
+
+	app.replyText(message, fmt.Sprintf("🔔 Subscription <code>%d</code> created, alerts matching <code>%v</code> will be delivered to this chat",
+		subscription.ID, html.EscapeString(matchers.String())), nil)
+}
+
+// subscriptionsCommand lists chat subscriptions
+func (app *Application) subscriptionsCommand(message *tgbotapi.Message, args []string) {
+	if app.subscriptionsDisabled(message) {
+		return
+	}
+
+	subscriptions, err := app.store.Subscriptions(message.Chat.ID)
+	if err != nil {
+		log.Println("Error while reading subscriptions:", message.Chat.ID, err)
+		app.replyText(message, "Cannot read subscriptions", nil)
+		return
+	}
+
+	text := new(bytes.Buffer)
+	fmt.Fprintf(text, "<b>Subscriptions: %d</b>\n", len(subscriptions))
+
+	for _, subscription := range subscriptions {
+		fmt.Fprintf(text, "\n<code>%d</code> <code>%v</code> by %v",
+			subscription.ID, html.EscapeString(subscription.Matchers.String()), html.EscapeString(subscription.CreatedBy))
+	}
+
+	app.replyText(message, text.String(), nil)
+}
+
+// unsubscribeCommand handles /unsubscribe <id>
+func (app *Application) unsubscribeCommand(message *tgbotapi.Message, args []string) {
+	if app.subscriptionsDisabled(message) {
+		return
+	}
+
+	id, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		app.replyText(message, "Subscription id should be a number from /subscriptions", nil)
+		return
+	}
+
+	deleted, err := app.store.DeleteSubscription(message.Chat.ID, id)
+	if err != nil {
+		log.Println("Error while removing subscription:", message.Chat.ID, err)
+		app.replyText(message, "Cannot remove subscription", nil)
+		return
+	}
+
+	if !deleted {
+		app.replyText(message, fmt.Sprintf("Subscription <code>%d</code> not found in this chat", id), nil)
+		return
+	}
+
+	app.replyText(message, fmt.Sprintf("🔕 Subscription <code>%d</code> removed", id), nil)
+}
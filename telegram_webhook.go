@@ -0,0 +1,66 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/telegram-bot-api.v4"
+)
+
+// setTelegramWebhook registers webhook of bot in Telegram, updates arrive to HTTPTelegramHandler
+func (app *Application) setTelegramWebhook() error {
+	webhook := app.config.TelegramWebhook
+
+	// SetWebhook of tgbotapi v4 does not know secret_token
+	_, err := app.bot.MakeRequest("setWebhook", url.Values{
+		"url":             {webhook.Endpoint()},
+		"secret_token":    {webhook.SecretToken},
+		"allowed_updates": {`["message","callback_query"]`},
+	})
+
+	return err
+}
+
+// routeTelegramWebhooks adds webhook routes of app and its bots which receive updates by webhook
+func (app *Application) routeTelegramWebhooks(router gin.IRoutes) {
+	if app.config.TelegramWebhook != nil {
+		router.POST(app.config.TelegramWebhook.Path, app.HTTPTelegramHandler)
+	}
+
+	for _, bot := range app.bots {
+		bot.routeTelegramWebhooks(router)
+	}
+}
+
+// HTTPTelegramHandler handles update sent by Telegram to registered webhook
+func (app *Application) HTTPTelegramHandler(c *gin.Context) {
+	// Telegram retries update, load balancer sends it to leader
+	if app.isStandby() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"desc": "standby replica"})
+		return
+	}
+
+	secret := c.GetHeader("X-Telegram-Bot-Api-Secret-Token")
+	if subtle.ConstantTimeCompare([]byte(secret), []byte(app.config.TelegramWebhook.SecretToken)) != 1 {
+		c.JSON(http.StatusUnauthorized, gin.H{"desc": "invalid secret token"})
+		return
+	}
+
+	var update tgbotapi.Update
+	if err := c.ShouldBindJSON(&update); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"desc": "invalid update", "errstr": err.Error()})
+		return
+	}
+
+	if app.config.Debug {
+		log.Printf("Webhook update %d", update.UpdateID)
+	}
+
+	// Telegram resends update until it gets 2xx response, so update is handled before answer
+	app.handleUpdate(update)
+
+	c.Status(http.StatusOK)
+}
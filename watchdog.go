@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"time"
+
+	"github.com/pechorin/prometheus_tbot/pkg/appconfig"
+)
+
+const watchdogCheckInterval = 30 * time.Second
+
+// watchdogState is heartbeat state of one receiver
+type watchdogState struct {
+	lastSeenAt time.Time
+	// pipeline down message was sent and recovery is not reported yet
+	down bool
+}
+
+// receiverWatchdog returns watchdog configured for receiver, nil when there is none
+func (app *Application) receiverWatchdog(receiver string) *appconfig.Watchdog {
+	for idx := range app.config.Watchdogs {
+		if app.config.Watchdogs[idx].Receiver == receiver {
+			return &app.config.Watchdogs[idx]
+		}
+	}
+
+	return nil
+}
+
+// splitHeartbeats removes heartbeat alerts of receiver watchdog from delivery. Returned
+// alerts are nil when only heartbeats were received
+func (app *Application) splitHeartbeats(alerts *Alerts, now time.Time) (notify *Alerts, heartbeat bool) {
+	watchdog := app.receiverWatchdog(alerts.Receiver)
+	if watchdog == nil {
+		return alerts, false
+	}
+
+	other := make([]Alert, 0, len(alerts.Alerts))
+
+	for _, alert := range alerts.Alerts {
+		if alert.StringLabels()["alertname"] != watchdog.AlertName {
+			other = append(other, alert)
+			continue
+		}
+
+		// resolved heartbeat means Prometheus stopped sending it, wait for timeout
+		if !alert.IsResolved() && (alert.EndsAtTime().IsZero() || alert.EndsAtTime().After(now)) {
+			heartbeat = true
+		}
+	}
+
+	if len(other) > 0 {
+		notify = alerts.WithAlerts(other)
+	}
+
+	return
+}
+
+// heartbeat records heartbeat of receiver and reports recovery when pipeline was down
+func (app *Application) heartbeat(receiver string, now time.Time) {
+	watchdog := app.receiverWatchdog(receiver)
+	if watchdog == nil {
+		return
+	}
+
+	app.watchdogsMu.Lock()
+	state := app.watchdogState(receiver, now)
+	wasDown, lastSeenAt := state.down, state.lastSeenAt
+	state.lastSeenAt = now
+	state.down = false
+	app.watchdogsMu.Unlock()
+
+	if wasDown {
+		app.notifyWatchdog(watchdog, fmt.Sprintf("✅ <b>Alerting pipeline recovered</b>: <code>%v</code> heartbeat from receiver <code>%v</code> received after %v of silence",
+			html.EscapeString(watchdog.AlertName), html.EscapeString(watchdog.Receiver), now.Sub(lastSeenAt).Round(time.Second)))
+	}
+}
+
+// watchdogState returns state of receiver, heartbeat is expected since bot start.
+// Caller should hold watchdogsMu
+func (app *Application) watchdogState(receiver string, now time.Time) *watchdogState {
+	state, ok := app.watchdogs[receiver]
+	if !ok {
+		state = &watchdogState{lastSeenAt: now}
+		app.watchdogs[receiver] = state
+	}
+
+	return state
+}
+
+// runWatchdogs periodically checks that heartbeats arrive in time
+func (app *Application) runWatchdogs() {
+	app.every(watchdogCheckInterval, app.checkWatchdogs)
+}
+
+// checkWatchdogs reports receivers without heartbeat during watchdog interval, every
+// outage is reported once
+func (app *Application) checkWatchdogs(now time.Time) {
+	for idx := range app.config.Watchdogs {
+		watchdog := &app.config.Watchdogs[idx]
+
+		app.watchdogsMu.Lock()
+		state := app.watchdogState(watchdog.Receiver, now)
+		expired := !state.down && now.Sub(state.lastSeenAt) > watchdog.Interval.Duration
+		if expired {
+			state.down = true
+		}
+		lastSeenAt := state.lastSeenAt
+		app.watchdogsMu.Unlock()
+
+		if expired {
+			app.notifyWatchdog(watchdog, fmt.Sprintf("🚨 <b>Alerting pipeline is down</b>: no <code>%v</code> heartbeat from receiver <code>%v</code> since %v, Alertmanager or Prometheus may be not working",
+				html.EscapeString(watchdog.AlertName), html.EscapeString(watchdog.Receiver), app.formatTime(lastSeenAt)))
+		}
+	}
+}
+
+func (app *Application) notifyWatchdog(watchdog *appconfig.Watchdog, text string) {
+	for _, chatID := range watchdog.Chats {
+		app.SendPages(chatID, []*bytes.Buffer{bytes.NewBufferString(text)}, SendOptions{})
+	}
+}